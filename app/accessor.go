@@ -1,14 +1,11 @@
 package app
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 
-	"github.com/BurntSushi/toml"
-	"github.com/go-yaml/yaml"
 	"github.com/morikuni/accessor"
 )
 
@@ -21,81 +18,111 @@ func ErrUnknownFormat(format string) error {
 	return fmt.Errorf("unknown format: %q", format)
 }
 
-func decodeToAccessor(format string, input io.Reader) (accessor.Accessor, error) {
+// codec decodes a document of a format and encodes it back.
+// a codec is used for only one document, so that it can keep
+// the original layout of the document to reproduce it on encoding.
+type codec interface {
+	decode(input io.Reader) (accessor.Accessor, error)
+	encode(output io.Writer, acc accessor.Accessor) error
+}
+
+// recordCodec processes a stream of records one at a time.
+// fn is called with each record before it is written to output.
+type recordCodec interface {
+	process(input io.Reader, output io.Writer, fn func(acc accessor.Accessor) error) error
+}
+
+// isRecordFormat reports whether format is a stream of records processed by a recordCodec.
+func isRecordFormat(format string) bool {
+	return format == "ndjson" || format == "csv"
+}
+
+func newRecordCodec(format string, opts codecOptions) (recordCodec, error) {
 	switch format {
-	case "":
-		return nil, ErrFormatRequired
-	case "json":
-		var obj interface{}
-		err := json.NewDecoder(input).Decode(&obj)
-		if err != nil {
-			if err == io.EOF {
-				return nil, ErrEmptyInput
-			}
-			return nil, err
-		}
-		return accessor.NewAccessor(obj)
-	case "yaml":
-		bs, err := ioutil.ReadAll(input)
-		if err != nil {
-			return nil, err
-		}
-		if len(bs) == 0 {
-			return nil, ErrEmptyInput
-		}
-		var obj interface{}
-		err = yaml.Unmarshal(bs, &obj)
-		if err != nil {
-			return nil, err
-		}
-		return accessor.NewAccessor(obj)
-	case "toml":
-		bs, err := ioutil.ReadAll(input)
-		if err != nil {
-			return nil, err
-		}
-		if len(bs) == 0 {
-			return nil, ErrEmptyInput
-		}
-		var obj interface{}
-		_, err = toml.Decode(string(bs), &obj)
-		if err != nil {
-			return nil, err
-		}
-		return accessor.NewAccessor(obj)
-	case "text":
-		bs, err := ioutil.ReadAll(input)
-		if err != nil {
-			return nil, err
-		}
-		if len(bs) == 0 {
-			return nil, ErrEmptyInput
-		}
-		return accessor.NewAccessor(string(bs))
+	case "ndjson":
+		return ndjsonCodec{}, nil
+	case "csv":
+		return csvCodec{delimiter: opts.delimiter, noHeader: opts.noHeader}, nil
 	default:
 		return nil, ErrUnknownFormat(format)
 	}
 }
 
-func encodeAccessor(format string, output io.Writer, acc accessor.Accessor) error {
+// codecOptions are options of codecs given by flags.
+type codecOptions struct {
+	// indent overrides the indentation of json output.
+	indent string
+	// documentNames prefixes paths of documents in a yaml stream by kind and name.
+	documentNames bool
+	// delimiter separates fields of csv.
+	delimiter rune
+	// noHeader treats the first row of csv as data instead of a header.
+	noHeader bool
+}
+
+func newCodec(format string, opts codecOptions) (codec, error) {
 	switch format {
 	case "":
-		return ErrFormatRequired
+		return nil, ErrFormatRequired
 	case "json":
-		return json.NewEncoder(output).Encode(acc.Unwrap())
+		return &jsonCodec{indent: opts.indent}, nil
 	case "yaml":
-		bs, err := yaml.Marshal(acc.Unwrap())
-		if err != nil {
-			return err
-		}
-		_, err = output.Write(bs)
-		return err
+		return &yamlCodec{documentNames: opts.documentNames}, nil
 	case "toml":
-		return toml.NewEncoder(output).Encode(acc.Unwrap())
+		return &tomlCodec{}, nil
+	case "dotenv":
+		return &dotenvCodec{}, nil
+	case "ini":
+		return &iniCodec{}, nil
+	case "properties":
+		return &propertiesCodec{}, nil
+	case "hcl":
+		return &hclCodec{}, nil
+	case "xml":
+		return &xmlCodec{}, nil
 	case "text":
-		_, err := output.Write([]byte(acc.Unwrap().(string)))
-		return err
+		return &textCodec{}, nil
 	default:
-		return fmt.Errorf("unknown type: %q", format)
+		return nil, ErrUnknownFormat(format)
+	}
+}
+
+// decodeToAccessor decodes input of the format.
+// the returned codec must be used to encode the document.
+func decodeToAccessor(format string, opts codecOptions, input io.Reader) (accessor.Accessor, codec, error) {
+	c, err := newCodec(format, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	acc, err := c.decode(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acc, c, nil
+}
+
+func readAllNotEmpty(input io.Reader) ([]byte, error) {
+	bs, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
 	}
+	if len(bs) == 0 {
+		return nil, ErrEmptyInput
+	}
+	return bs, nil
+}
+
+type textCodec struct{}
+
+func (textCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	return accessor.NewAccessor(string(bs))
+}
+
+func (textCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	_, err := output.Write([]byte(acc.Unwrap().(string)))
+	return err
 }
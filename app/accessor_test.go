@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/morikuni/accessor"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -128,7 +129,7 @@ func TestDecodeToAccessor(t *testing.T) {
 		t.Run(test.Title, func(t *testing.T) {
 			assert := assert.New(t)
 
-			acc, err := decodeToAccessor(test.Input.Format, bytes.NewBufferString(test.Input.Text))
+			acc, _, err := decodeToAccessor(test.Input.Format, codecOptions{}, bytes.NewBufferString(test.Input.Text))
 
 			if test.Expect.IsNilAccessor {
 				assert.Nil(acc)
@@ -139,3 +140,11 @@ func TestDecodeToAccessor(t *testing.T) {
 		})
 	}
 }
+
+func mustParsePath(t *testing.T, s string) accessor.Path {
+	path, err := accessor.ParsePath(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
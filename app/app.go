@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"time"
 
 	"github.com/morikuni/accessor"
+	"github.com/morikuni/gipher"
 	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ed25519"
 )
 
 var DryrunMessage = "THIS FIELD WILL BE CHENGED"
@@ -26,12 +29,40 @@ func (a app) Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Wri
 	help := flag.BoolP("help", "h", false, "print this message.")
 	inputFile := flag.StringP("file", "f", "", "file path to input.")
 	outputFile := flag.StringP("output", "o", "", "file path to output.")
-	format := flag.String("format", "text", `"text", "json", "yaml", or "toml"`)
+	format := flag.String("format", "", `"text", "json", "yaml", "toml", "dotenv", "ini", "properties", "hcl", "xml", "ndjson", "csv", or "binary" ("raw" is an alias of "binary"). detected from the extension of the input/output file or the input if not given.`)
+	indent := flag.String("indent", "", `indentation of "json" output. a number of spaces or "tab". the original indentation is kept by default.`)
+	documentNames := flag.Bool("document-names", false, `prefix paths of documents in a "yaml" stream by kind and name of kubernetes resources after the index (e.g. "1/Secret/db/data/password").`)
+	delimiter := flag.String("delimiter", ",", `field delimiter of "csv". a character or "tab".`)
+	noHeader := flag.Bool("no-header", false, `read the first row of "csv" as data, and use column indices in paths (e.g. "0/2") instead of headers.`)
+	armor := flag.Bool("armor", false, `encode output of "binary" format as text.`)
 	pattern := flag.String("pattern", ".*", `regular expression. only fields matching the pattern are encrypted/decrypted (e.g. "user/items/.*/name").`)
 	cryptorType := flag.String("cryptor", "password", `"password" or "aws-kms".`)
 	awsKeyID := flag.String("aws-key-id", "", "key id for aws kms. (required when cryptor is aws-kms)")
 	awsRegion := flag.String("aws-region", "", "aws region. (required when cryptor is aws-kms)")
+	awsEndpoint := flag.String("aws-endpoint", "", "custom endpoint for aws kms.")
+	awsProfile := flag.String("aws-profile", "", "profile for aws. (overrides AWS_PROFILE)")
+	awsRoleARN := flag.String("aws-role-arn", "", "arn of the role assumed to call aws kms.")
+	awsExternalID := flag.String("aws-external-id", "", "external id used when assuming the role.")
+	awsSessionName := flag.String("aws-role-session-name", "", "session name used when assuming the role.")
+	awsMaxAttempts := flag.Int("aws-max-attempts", gipher.DefaultRetryPolicy.MaxAttempts, "maximum number of attempts for a throttled aws kms call.")
+	awsMaxDelay := flag.Duration("aws-max-delay", gipher.DefaultRetryPolicy.MaxDelay, "maximum delay between attempts for aws kms calls.")
+	awsDataKey := flag.Bool("aws-data-key", false, "encrypt fields locally with a data key generated by aws kms once.")
+	awsCacheMaxEntries := flag.Int("aws-cache-max-entries", 100, "maximum number of data keys cached on decryption. 0 disables the cache.")
+	awsCacheMaxAge := flag.Duration("aws-cache-max-age", 5*time.Minute, "maximum age of cached data keys. 0 means they never expire.")
+	encoding := flag.String("encoding", "base64", `encoding of encrypted values. "base64", "base64url", "hex", "base32", or "armor". (decryption detects the encoding automatically)`)
+	compress := flag.String("compress", "", `compress values before encryption. "gzip" is supported. (decryption detects compression automatically)`)
+	compressThreshold := flag.Int("compress-threshold", 256, "minimum size in bytes of values to be compressed.")
+	padding := flag.String("padding", "", `pad values before encryption to hide their length. "multiple:<size>" or "buckets:<size>,<size>,..." (e.g. "buckets:16,64,256").`)
+	marker := flag.Bool("marker", false, `wrap encrypted values by "ENC[...]" and decrypt only such values. values already wrapped are never encrypted again.`)
+	metadata := flag.Bool("metadata", false, `record the version and flags used for encryption in the "gipher" field of the document. decryption reads flags not given from the field after the mac is verified, and the cryptor and aws flags only if --metadata is given.`)
+	mac := flag.Bool("mac", false, `store a mac of the whole document in the "gipher" field on encryption, and require it on decryption. documents with the field always require it, and documents with metadata or a signature always get it.`)
+	ignoreMAC := flag.Bool("ignore-mac", false, "decrypt without verifying the mac of the document.")
+	signingKeyFile := flag.String("signing-key", "", "file path to an ed25519 private key to sign the document on encryption. (created by keygen)")
+	trustedKeysFile := flag.String("trusted-keys", "", "file path to ed25519 public keys trusted on verification, one per line.")
+	requireSignature := flag.Bool("require-signature", false, "fail decryption unless the document is signed by a trusted key.")
 	dryrun := flag.Bool("dryrun", false, `display fields to be affected as "THIS FIELD WILL BE CHENGED", without operation.`)
+	verbose := flag.BoolP("verbose", "v", false, "print details of the operation to stderr.")
+	concurrency := flag.Int("concurrency", 1, "number of fields encrypted/decrypted in parallel.")
 	flag.Usage = func() {
 		fmt.Fprintln(stderr)
 		fmt.Fprintln(stderr, "Usage: gipher <command> [flags]")
@@ -39,6 +70,8 @@ func (a app) Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Wri
 		fmt.Fprintln(stderr, "Commands:")
 		fmt.Fprintln(stderr, "      encrypt               encrypt a file.")
 		fmt.Fprintln(stderr, "      decrypt               decrypt a encrypted file.")
+		fmt.Fprintln(stderr, "      verify                verify the signature of a encrypted file.")
+		fmt.Fprintln(stderr, "      keygen                generate a key to sign encrypted files.")
 		fmt.Fprintln(stderr)
 		fmt.Fprintln(stderr, "Flags:")
 		fmt.Fprintln(stderr, flag.FlagUsages())
@@ -73,6 +106,54 @@ func (a app) Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Wri
 		return 1
 	}
 
+	if *concurrency < 1 {
+		fmt.Fprintln(stderr, "concurrency must be greater than 0")
+		return 1
+	}
+
+	indentString, err := parseIndent(*indent)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	delimiterRune, err := parseDelimiter(*delimiter)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if command == "keygen" {
+		err = generateKeyFile(stdout, stderr, *outputFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	var signingKey ed25519.PrivateKey
+	if command == "encrypt" && *signingKeyFile != "" {
+		signingKey, err = readSigningKey(*signingKeyFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	var trustedKeys []ed25519.PublicKey
+	if command == "verify" || (command == "decrypt" && *requireSignature) {
+		if *trustedKeysFile == "" {
+			fmt.Fprintln(stderr, ErrTrustedKeysMissing)
+			return 1
+		}
+		trustedKeys, err = readTrustedKeys(*trustedKeysFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
 	reg, err := regexp.Compile(*pattern)
 	if err != nil {
 		fmt.Fprintf(stderr, "invalid pattern: %s\n", err)
@@ -87,55 +168,268 @@ func (a app) Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Wri
 	defer input.Close()
 	defer output.Close()
 
-	acc, err := decodeToAccessor(*format, input)
+	var reader io.Reader = input
+	if *format == "" {
+		*format, reader, err = detectFormat(*inputFile, *outputFile, input)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if isStreamFormat(*format) && *compress != "" {
+		fmt.Fprintf(stderr, "compress cannot be used with %q format\n", *format)
+		return 1
+	}
+	if isStreamFormat(*format) && *padding != "" {
+		fmt.Fprintf(stderr, "padding cannot be used with %q format\n", *format)
+		return 1
+	}
+	// records and streams are processed piece by piece, so nothing about the whole input can be stored in it.
+	if isStreamFormat(*format) || isRecordFormat(*format) {
+		var name string
+		switch {
+		case *mac:
+			name = "mac"
+		case *metadata:
+			name = "metadata"
+		case *signingKeyFile != "":
+			name = "signing-key"
+		}
+		if name != "" {
+			fmt.Fprintf(stderr, "%s cannot be used with %q format\n", name, *format)
+			return 1
+		}
+	}
+
+	opts := codecOptions{
+		indent:        indentString,
+		documentNames: *documentNames,
+		delimiter:     delimiterRune,
+		noHeader:      *noHeader,
+	}
+	var (
+		acc   accessor.Accessor
+		codec codec
+	)
+	if !isStreamFormat(*format) && !isRecordFormat(*format) {
+		acc, codec, err = decodeToAccessor(*format, opts, reader)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if command == "verify" || (command == "decrypt" && *requireSignature) {
+		if acc == nil {
+			fmt.Fprintf(stderr, "cannot verify the signature of %q format\n", *format)
+			return 1
+		}
+		err = verifySignature(trustedKeys, acc)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if command == "verify" {
+			fmt.Fprintln(stdout, "signature is valid")
+			return 0
+		}
+	}
+
+	// flags needed to create the cryptor cannot be read after the mac is verified by the cryptor,
+	// so the document chooses the cryptor only if the user trusts it by --metadata.
+	if command == "decrypt" && acc != nil && *metadata {
+		err = readFlagsFromMetadata(acc, flag, true)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	cryptor, err := createCryptor(*cryptorType, command, gipher.AWSKMSOptions{
+		Region:      *awsRegion,
+		KeyID:       *awsKeyID,
+		Endpoint:    *awsEndpoint,
+		Profile:     *awsProfile,
+		RoleARN:     *awsRoleARN,
+		ExternalID:  *awsExternalID,
+		SessionName: *awsSessionName,
+		Retry: gipher.RetryPolicy{
+			MaxAttempts: *awsMaxAttempts,
+			BaseDelay:   gipher.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:    *awsMaxDelay,
+		},
+		DataKey: *awsDataKey,
+		Cache:   gipher.NewDataKeyCache(*awsCacheMaxEntries, *awsCacheMaxAge),
+	})
 	if err != nil {
 		fmt.Fprintln(stderr, err)
 		return 1
 	}
 
-	cryptor, err := createCryptor(*cryptorType, command, *awsRegion, *awsKeyID)
+	if rc, ok := cryptor.(gipher.RetryCounter); ok && *verbose {
+		defer func() {
+			fmt.Fprintf(stderr, "retries: %d\n", rc.Retries())
+		}()
+	}
+
+	cryptor, err = wrapCryptor(cryptor, *encoding, *compress, *compressThreshold, *padding)
 	if err != nil {
 		fmt.Fprintln(stderr, err)
 		return 1
 	}
 
-	err = acc.Foreach(func(path accessor.Path, value interface{}) error {
-		if !reg.MatchString(path.String()) {
-			return nil
+	if command == "decrypt" && acc != nil {
+		// the mac is required for documents with the metadata section, so that it cannot be removed alone.
+		// documents written before the mac was introduced have no section.
+		if !*dryrun && !*ignoreMAC {
+			if hasMAC(acc) {
+				err = verifyMAC(cryptor, acc)
+			} else if *mac || getMetadata(acc) != nil {
+				err = ErrMACMissing
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
 		}
 
+		err = readFlagsFromMetadata(acc, flag, false)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		reg, err = regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid pattern: %s\n", err)
+			return 1
+		}
+	}
+
+	if isStreamFormat(*format) {
 		if *dryrun {
-			return acc.Set(path, DryrunMessage)
+			fmt.Fprint(output, DryrunMessage)
+			return 0
+		}
+		err = processStream(command, cryptor, reader, output, *armor)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if yc, ok := codec.(*yamlCodec); ok {
+		err = yc.checkPattern(acc, *pattern)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
 		}
+	}
 
-		switch command {
-		case "encrypt":
-			cipher, shouldSet, err := encrypt(cryptor, value)
-			if err != nil {
-				return err
+	// process encrypts/decrypts fields of a document matching the pattern.
+	process := func(acc accessor.Accessor) error {
+		var fields []field
+		err := acc.Foreach(func(path accessor.Path, value interface{}) error {
+			if isMetadataPath(path) {
+				return nil
 			}
-			if shouldSet {
-				return acc.Set(path, cipher)
+			if reg.MatchString(path.String()) {
+				fields = append(fields, field{path, value})
 			}
-		case "decrypt":
-			if s, ok := value.(string); ok {
-				value, err := decrypt(cryptor, s)
-				if err != nil {
-					return err
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		results, err := processFields(fields, *concurrency, func(value interface{}) (interface{}, bool, error) {
+			if *dryrun {
+				return DryrunMessage, true, nil
+			}
+
+			switch command {
+			case "encrypt":
+				cipher, shouldSet, err := encrypt(cryptor, value, *marker)
+				return cipher, shouldSet, err
+			case "decrypt":
+				if s, ok := value.(string); ok {
+					return decrypt(cryptor, s, *marker)
 				}
-				return acc.Set(path, value)
+				return nil, false, nil
+			default:
+				return nil, false, fmt.Errorf("unknown command: %s", command)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, r := range results {
+			if !r.shouldSet {
+				continue
+			}
+			if err := acc.Set(fields[i].path, r.value); err != nil {
+				return err
 			}
-		default:
-			return fmt.Errorf("unknown command: %s", command)
 		}
 		return nil
-	})
+	}
+
+	if isRecordFormat(*format) {
+		rc, err := newRecordCodec(*format, opts)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		err = rc.process(reader, output, process)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	err = process(acc)
 	if err != nil {
 		fmt.Fprintln(stderr, err)
 		return 1
 	}
 
-	err = encodeAccessor(*format, output, acc)
+	if command == "encrypt" && !*dryrun && *metadata {
+		err = writeFlagsToMetadata(acc, flag)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	// the metadata section and the signature are protected by the mac too.
+	if command == "encrypt" && !*dryrun && (*mac || canStoreMetadata(*format, acc) && (getMetadata(acc) != nil || signingKey != nil)) {
+		err = addMAC(cryptor, acc)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if signingKey != nil && !*dryrun {
+		err = addSignature(signingKey, acc)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if command == "decrypt" {
+		acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	err = codec.encode(output, acc)
 	if err != nil {
 		fmt.Fprintln(stderr, err)
 		return 1
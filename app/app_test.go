@@ -3,7 +3,10 @@ package app
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -132,7 +135,46 @@ func TestApp(t *testing.T) {
 			},
 			Expect: Expect{
 				ExitCode: 0,
-				Stdout:   fmt.Sprintf(`{"age":18,"name":"%s"}`, DryrunMessage),
+				Stdout:   fmt.Sprintf(`\{\s+"name": "%s",\s+"age": 18\s+\}`, DryrunMessage),
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "dryrun detected format",
+			Input: Input{
+				Args:  "gipher encrypt --pattern name --dryrun",
+				Stdin: "# user\nname: Alice\nage: 18\n",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   fmt.Sprintf(`\A# user\nname: %s\nage: 18\n\z`, DryrunMessage),
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "undetected format",
+			Input: Input{
+				Args:  "gipher encrypt --pattern name",
+				Stdin: "name=Alice\n",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `cannot detect the format of the input: specify --format`,
+			},
+		},
+		{
+			Title: "dryrun ndjson",
+			Input: Input{
+				Args:  "gipher encrypt --format ndjson --pattern name --dryrun",
+				Stdin: "{\"name\":\"Alice\",\"age\":18}\n{\"name\":\"Bob\",\"age\":20}\n",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   fmt.Sprintf(`\A\{"name":"%[1]s","age":18\}\n\{"name":"%[1]s","age":20\}\n\z`, DryrunMessage),
 				Stderr:   `\A\z`,
 			},
 		},
@@ -149,10 +191,23 @@ func TestApp(t *testing.T) {
 			},
 			Expect: Expect{
 				ExitCode: 0,
-				Stdout:   `{"age":18,"name":"[0-9a-zA-Z+=/]{40}"}`,
+				Stdout:   `\{\s+"name": "[0-9a-zA-Z+=/]{40}",\s+"age": 18\s+\}`,
 				Stderr:   `\A\z`,
 			},
 		},
+		{
+			Title: "encrypt: ini section clashes with a global key",
+			Input: Input{
+				Args:  "gipher encrypt --format ini",
+				Stdin: "db = x\n[db]\nuser = a\n",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `section "db" has the same name as a global key`,
+			},
+		},
 		{
 			Title: "decrypt: success password",
 			Input: Input{
@@ -166,7 +221,328 @@ func TestApp(t *testing.T) {
 			},
 			Expect: Expect{
 				ExitCode: 0,
-				Stdout:   `{"age":18,"name":"Alice"}`,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: success marked password",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name",
+				Stdin: `{
+						"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "invalid concurrency",
+			Input: Input{
+				Args:  "gipher encrypt --concurrency 0",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `concurrency must be greater than 0`,
+			},
+		},
+		{
+			Title: "decrypt: success concurrency",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name --concurrency 4",
+				Stdin: `{
+						"users": [
+							{"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"},
+							{"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"},
+							{"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"}
+						]
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `"users": \[\s+\{"name": "Alice"\},\s+\{"name": "Alice"\},\s+\{"name": "Alice"\}\s+\]`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: invalid binary",
+			Input: Input{
+				Args:  "gipher decrypt --format binary",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `invalid encrypted stream`,
+			},
+		},
+		{
+			Title: "unknown compression",
+			Input: Input{
+				Args:  "gipher encrypt --compress lzma",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `unknown compression: "lzma"`,
+			},
+		},
+		{
+			Title: "compress binary",
+			Input: Input{
+				Args:  "gipher encrypt --format binary --compress gzip",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `compress cannot be used with "binary" format`,
+			},
+		},
+		{
+			Title: "invalid padding",
+			Input: Input{
+				Args:  "gipher encrypt --padding multiple:0",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `invalid padding: "multiple:0"`,
+			},
+		},
+		{
+			Title: "padding binary",
+			Input: Input{
+				Args:  "gipher encrypt --format raw --padding multiple:16",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `padding cannot be used with "raw" format`,
+			},
+		},
+		{
+			Title: "encrypt: mac with ndjson",
+			Input: Input{
+				Args:  "gipher encrypt --format ndjson --mac",
+				Stdin: "",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `mac cannot be used with "ndjson" format`,
+			},
+		},
+		{
+			Title: "encrypt: metadata with csv",
+			Input: Input{
+				Args:  "gipher encrypt --format csv --metadata",
+				Stdin: "",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `metadata cannot be used with "csv" format`,
+			},
+		},
+		{
+			Title: "encrypt: metadata with binary",
+			Input: Input{
+				Args:  "gipher encrypt --format binary --metadata",
+				Stdin: "",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `metadata cannot be used with "binary" format`,
+			},
+		},
+		{
+			Title: "encrypt: success padding",
+			Input: Input{
+				Args: "gipher encrypt --format json --pattern name --padding multiple:32",
+				Stdin: `{
+						"name": "Alice",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "[0-9a-zA-Z+=/]{88}",\s+"age": 18\s+\}`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "unknown encoding",
+			Input: Input{
+				Args:  "gipher encrypt --encoding base128",
+				Stdin: "aaa",
+				Env:   passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `unknown encoding: "base128"`,
+			},
+		},
+		{
+			Title: "encrypt: success hex",
+			Input: Input{
+				Args: "gipher encrypt --format json --pattern name --encoding hex",
+				Stdin: `{
+						"name": "Alice",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "hex:[0-9a-f]{56}",\s+"age": 18\s+\}`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: success hex",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name",
+				Stdin: `{
+						"name": "ENC[hex:4759722c04c8786242e546041a77be2ad3abe15cd6b27d2a7aac6327]",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "encrypt: success marker",
+			Input: Input{
+				Args: "gipher encrypt --format json --marker",
+				Stdin: `{
+						"name": "Alice",
+						"password": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "ENC\[[0-9a-zA-Z+=/]{40}\]",\s+"password": "ENC\[R1lyLATIeGJC5UYEGne\+KtOr4VzWsn0qeqxjJw==\]"\s+\}`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: success marker",
+			Input: Input{
+				Args: "gipher decrypt --format json --marker",
+				Stdin: `{
+						"name": "Alice",
+						"password": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "Alice",\s+"password": "Alice"\s+\}`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: unmarked values are left alone",
+			Input: Input{
+				Args: "gipher decrypt --format json --marker",
+				Stdin: `{
+						"name": "R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==",
+						"password": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]"
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "R1lyLATIeGJC5UYEGne\+KtOr4VzWsn0qeqxjJw==",\s+"password": "Alice"\s+\}`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: success without marker",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name --marker=false",
+				Stdin: `{
+						"name": "R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
+				Stderr:   `\A\z`,
+			},
+		},
+		{
+			Title: "decrypt: mac is missing",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name --mac",
+				Stdin: `{
+						"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]",
+						"age": 18
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stdout:   `\A\z`,
+				Stderr:   `mac is missing in the document`,
+			},
+		},
+		{
+			Title: "decrypt: ignore mac",
+			Input: Input{
+				Args: "gipher decrypt --format json --pattern name --ignore-mac",
+				Stdin: `{
+						"name": "ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]",
+						"age": 18,
+						"gipher": {"mac": "00", "mac_key": "R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw=="}
+					}
+				`,
+				Env: passwordEnv,
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
 				Stderr:   `\A\z`,
 			},
 		},
@@ -205,7 +581,7 @@ func TestApp(t *testing.T) {
 			},
 			Expect: Expect{
 				ExitCode: 0,
-				Stdout:   `{"age":18,"name":"[0-9a-zA-Z+=/]{100,}"}`,
+				Stdout:   `\{\s+"name": "[0-9a-zA-Z+=/]{100,}",\s+"age": 18\s+\}`,
 				Stderr:   `\A\z`,
 			},
 		})
@@ -224,7 +600,7 @@ func TestApp(t *testing.T) {
 			},
 			Expect: Expect{
 				ExitCode: 0,
-				Stdout:   `{"age":18,"name":"Alice"}`,
+				Stdout:   `\{\s+"name": "Alice",\s+"age": 18\s+\}\s+\z`,
 				Stderr:   `\A\z`,
 			},
 		})
@@ -254,3 +630,277 @@ func TestApp(t *testing.T) {
 		})
 	}
 }
+
+func TestAppBinary(t *testing.T) {
+	type Input struct {
+		Args string
+	}
+	type Expect struct {
+		Armored bool
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "binary",
+			Input: Input{
+				Args: "--format binary",
+			},
+			Expect: Expect{
+				Armored: false,
+			},
+		},
+		{
+			Title: "raw with armor",
+			Input: Input{
+				Args: "--format raw --armor",
+			},
+			Expect: Expect{
+				Armored: true,
+			},
+		},
+	}
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	plaintext := strings.Repeat("binary\x00data\xff", 10000)
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			encrypted := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			exitCode := NewApp().Run(strings.Fields("gipher encrypt "+test.Input.Args), strings.NewReader(plaintext), encrypted, stderr)
+			assert.Equal(0, exitCode)
+			assert.Equal("", stderr.String())
+			assert.Equal(test.Expect.Armored, gipher.IsArmored(encrypted.Bytes()))
+
+			decrypted := &bytes.Buffer{}
+			exitCode = NewApp().Run(strings.Fields("gipher decrypt "+test.Input.Args), encrypted, decrypted, stderr)
+			assert.Equal(0, exitCode)
+			assert.Equal("", stderr.String())
+			assert.Equal(plaintext, decrypted.String())
+		})
+	}
+}
+
+func TestAppMAC(t *testing.T) {
+	type Input struct {
+		Tamper func(s string) string
+	}
+	type Expect struct {
+		ExitCode int
+		Stderr   string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "not tampered",
+			Input: Input{
+				Tamper: func(s string) string { return s },
+			},
+			Expect: Expect{
+				ExitCode: 0,
+				Stderr:   "",
+			},
+		},
+		{
+			Title: "value changed",
+			Input: Input{
+				Tamper: func(s string) string { return strings.Replace(s, `"age":18`, `"age":81`, 1) },
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stderr:   ErrMACMismatch.Error(),
+			},
+		},
+		{
+			Title: "metadata changed",
+			Input: Input{
+				Tamper: func(s string) string { return strings.Replace(s, `"pattern":"name"`, `"pattern":"age"`, 1) },
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stderr:   ErrMACMismatch.Error(),
+			},
+		},
+		{
+			Title: "mac key changed",
+			Input: Input{
+				Tamper: func(s string) string { return strings.Replace(s, `"mac_key":"`, `"mac_key":"AAAA`, 1) },
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stderr:   "cannot decrypt the mac key",
+			},
+		},
+		{
+			Title: "mac removed",
+			Input: Input{
+				Tamper: func(s string) string { return regexp.MustCompile(`"mac":"[0-9a-f]+",`).ReplaceAllString(s, "") },
+			},
+			Expect: Expect{
+				ExitCode: 1,
+				Stderr:   ErrMACMissing.Error(),
+			},
+		},
+	}
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	encrypted := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode := NewApp().Run(strings.Fields("gipher encrypt --format json --pattern name --metadata"), strings.NewReader(`{"name":"Alice","age":18}`), encrypted, stderr)
+	if exitCode != 0 {
+		t.Fatal(stderr.String())
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			decrypted := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			exitCode := NewApp().Run(strings.Fields("gipher decrypt --format json --pattern name"), strings.NewReader(test.Input.Tamper(encrypted.String())), decrypted, stderr)
+			assert.Equal(test.Expect.ExitCode, exitCode)
+			assert.Contains(stderr.String(), test.Expect.Stderr)
+			if test.Expect.ExitCode == 0 {
+				assert.Equal(`{"name":"Alice","age":18}`, decrypted.String())
+			}
+		})
+	}
+}
+
+func TestAppMACFlatFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	// dotenv cannot hold the metadata section, so the mac cannot be stored.
+	encrypted := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode := NewApp().Run(strings.Fields("gipher encrypt --format dotenv"), strings.NewReader("PASSWORD=secret\n"), encrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+
+	decrypted := &bytes.Buffer{}
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format dotenv"), bytes.NewReader(encrypted.Bytes()), decrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Equal("PASSWORD=secret\n", decrypted.String())
+
+	exitCode = NewApp().Run(strings.Fields("gipher encrypt --format dotenv --mac"), strings.NewReader("PASSWORD=secret\n"), encrypted, stderr)
+	assert.Equal(1, exitCode)
+}
+
+func TestAppMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	encrypted := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode := NewApp().Run(strings.Fields("gipher encrypt --format json --pattern name --marker --metadata"), strings.NewReader(`{"name":"Alice","age":18}`), encrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Contains(encrypted.String(), `"gipher":{"cryptor":"password","encoding":"base64","mac":"`)
+	assert.Contains(encrypted.String(), `"marker":"true","pattern":"name","version":"`)
+
+	// pattern and marker are read from the metadata.
+	decrypted := &bytes.Buffer{}
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format json"), bytes.NewReader(encrypted.Bytes()), decrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Equal(`{"name":"Alice","age":18}`, decrypted.String())
+
+	// flags given explicitly take precedence.
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format json --cryptor unknown"), bytes.NewReader(encrypted.Bytes()), decrypted, stderr)
+	assert.Equal(1, exitCode)
+	assert.Contains(stderr.String(), `unknown cryptor: "unknown"`)
+
+	// the mac is verified before flags are read from the metadata.
+	stderr.Reset()
+	tampered := strings.Replace(encrypted.String(), `"pattern":"name"`, `"pattern":"("`, 1)
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format json"), strings.NewReader(tampered), decrypted, stderr)
+	assert.Equal(1, exitCode)
+	assert.Contains(stderr.String(), ErrMACMismatch.Error())
+
+	// the cryptor is not chosen by the document unless --metadata is given.
+	stderr.Reset()
+	tampered = strings.Replace(encrypted.String(), `"cryptor":"password"`, `"aws_region":"us-east-1","cryptor":"aws-kms"`, 1)
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format json --verbose"), strings.NewReader(tampered), decrypted, stderr)
+	assert.Equal(1, exitCode)
+	assert.Contains(stderr.String(), ErrMACMismatch.Error())
+	assert.NotContains(stderr.String(), "retries")
+
+	stderr.Reset()
+	decrypted.Reset()
+	exitCode = NewApp().Run(strings.Fields("gipher decrypt --format json --verbose --ignore-mac"), strings.NewReader(`{"name":"ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]","gipher":{"cryptor":"aws-kms","aws_region":"us-east-1"}}`), decrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Equal(`{"name":"Alice"}`, decrypted.String())
+}
+
+func TestAppSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	dir, err := ioutil.TempDir("", "gipher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	trustedFile := filepath.Join(dir, "trusted")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode := NewApp().Run([]string{"gipher", "keygen", "-o", keyFile}, strings.NewReader(""), stdout, stderr)
+	assert.Equal(0, exitCode)
+	publicKey := strings.TrimPrefix(strings.TrimSpace(stderr.String()), "public key: ")
+	if err := ioutil.WriteFile(trustedFile, []byte("# release pipeline\n"+publicKey+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// records cannot hold a signature of the whole input.
+	stderr.Reset()
+	exitCode = NewApp().Run([]string{"gipher", "encrypt", "--format", "ndjson", "--signing-key", keyFile}, strings.NewReader(`{"name":"Alice"}`), stdout, stderr)
+	assert.Equal(1, exitCode)
+	assert.Contains(stderr.String(), `signing-key cannot be used with "ndjson" format`)
+
+	encrypted := &bytes.Buffer{}
+	stderr.Reset()
+	exitCode = NewApp().Run([]string{"gipher", "encrypt", "--format", "json", "--pattern", "name", "--signing-key", keyFile}, strings.NewReader(`{"name":"Alice","age":18}`), encrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+
+	stdout.Reset()
+	exitCode = NewApp().Run([]string{"gipher", "verify", "--format", "json", "--trusted-keys", trustedFile}, bytes.NewReader(encrypted.Bytes()), stdout, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("signature is valid\n", stdout.String())
+
+	decrypted := &bytes.Buffer{}
+	exitCode = NewApp().Run([]string{"gipher", "decrypt", "--format", "json", "--pattern", "name", "--require-signature", "--trusted-keys", trustedFile}, bytes.NewReader(encrypted.Bytes()), decrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal(`{"name":"Alice","age":18}`, decrypted.String())
+
+	exitCode = NewApp().Run([]string{"gipher", "decrypt", "--format", "json", "--require-signature", "--trusted-keys", trustedFile}, strings.NewReader(`{"name":"R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==","age":18}`), decrypted, stderr)
+	assert.Equal(1, exitCode)
+	assert.Contains(stderr.String(), ErrSignatureMissing.Error())
+}
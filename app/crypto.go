@@ -3,42 +3,118 @@ package app
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/morikuni/gipher"
 )
 
-func createCryptor(cryptor, command, awsRegion, awsKeyID string) (gipher.Cryptor, error) {
+func createCryptor(cryptor, command string, awsOptions gipher.AWSKMSOptions) (gipher.Cryptor, error) {
 	switch cryptor {
 	case "":
 		return nil, errors.New("cryptor is required")
 	case "password":
 		return gipher.NewPasswordCryptorWithPrompt()
 	case "aws-kms":
-		if awsRegion == "" {
+		if awsOptions.Region == "" {
 			return nil, errors.New("aws-region is required for aws-kms")
 		}
-		if awsKeyID == "" && command == "encrypt" {
+		if awsOptions.KeyID == "" && command == "encrypt" {
 			return nil, errors.New("key-id is required for aws-kms")
 		}
-		return gipher.NewAWSKMSCryptor(awsRegion, awsKeyID)
+		return gipher.NewAWSKMSCryptorWithOptions(awsOptions)
 	default:
 		return nil, fmt.Errorf("unknown cryptor: %q", cryptor)
 	}
 }
 
-func decrypt(cryptor gipher.Cryptor, value string) (interface{}, error) {
-	text, err := cryptor.Decrypt(gipher.Ciphertext(value))
+// wrapCryptor adds processing of plaintexts around c.
+// c is always wrapped so that compressed or padded plaintexts are decrypted even if they are disabled.
+func wrapCryptor(c gipher.Cryptor, encoding string, compression string, compressThreshold int, padding string) (gipher.Cryptor, error) {
+	switch compression {
+	case "":
+		compressThreshold = -1
+	case "gzip":
+	default:
+		return nil, fmt.Errorf("unknown compression: %q", compression)
+	}
+	pad, err := parsePadding(padding)
+	if err != nil {
+		return nil, err
+	}
+	// compression is applied before padding so that padding hides the length of compressed plaintexts.
+	return gipher.NewEncodingCryptor(gipher.NewCompressCryptor(gipher.NewPadCryptor(c, pad), compressThreshold), gipher.Encoding(encoding))
+}
+
+// parsePadding parses "multiple:<size>" or "buckets:<size>,<size>,...".
+func parsePadding(padding string) (gipher.Padding, error) {
+	if padding == "" {
+		return nil, nil
+	}
+
+	s := strings.SplitN(padding, ":", 2)
+	if len(s) != 2 {
+		return nil, fmt.Errorf("invalid padding: %q", padding)
+	}
+	var sizes []int
+	for _, v := range strings.Split(s[1], ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || size < 1 {
+			return nil, fmt.Errorf("invalid padding: %q", padding)
+		}
+		sizes = append(sizes, size)
+	}
+
+	switch s[0] {
+	case "multiple":
+		if len(sizes) != 1 {
+			return nil, fmt.Errorf("invalid padding: %q", padding)
+		}
+		return gipher.PadToMultiple(sizes[0]), nil
+	case "buckets":
+		return gipher.PadToBuckets(sizes...), nil
+	default:
+		return nil, fmt.Errorf("invalid padding: %q", padding)
+	}
+}
+
+// decrypt decrypts value. marked values are always decrypted,
+// and unmarked values are decrypted only if onlyMarked is false.
+func decrypt(cryptor gipher.Cryptor, value string, onlyMarked bool) (interface{}, bool, error) {
+	ciphertext, ok := gipher.Unmark(value)
+	if !ok {
+		if onlyMarked {
+			return nil, false, nil
+		}
+		ciphertext = gipher.Ciphertext(value)
+	}
+	text, err := cryptor.Decrypt(ciphertext)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	return decodeFromString(text)
+	v, err := decodeFromString(text)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
 }
 
-func encrypt(cryptor gipher.Cryptor, value interface{}) (string, bool, error) {
+// encrypt encrypts value unless it is already marked as encrypted.
+// the result is marked if mark is true.
+func encrypt(cryptor gipher.Cryptor, value interface{}, mark bool) (string, bool, error) {
+	if s, ok := value.(string); ok && gipher.IsMarked(s) {
+		return "", false, nil
+	}
 	text, shouldSet := encodeToString(value)
 	if !shouldSet {
 		return "", shouldSet, nil
 	}
 	cipher, err := cryptor.Encrypt(text)
-	return string(cipher), true, err
+	if err != nil {
+		return "", true, err
+	}
+	if mark {
+		return gipher.Mark(cipher), true, nil
+	}
+	return string(cipher), true, nil
 }
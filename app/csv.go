@@ -0,0 +1,127 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/morikuni/accessor"
+)
+
+// csvCodec reads csv a row at a time.
+// each row is a record whose paths are "<row>/<column>", where the row is counted from 0
+// after the header and the column is its header, or its index if noHeader is set.
+// rows are written back as soon as they are processed, quoted only where needed.
+type csvCodec struct {
+	delimiter rune
+	noHeader  bool
+}
+
+func (c csvCodec) process(input io.Reader, output io.Writer, fn func(acc accessor.Accessor) error) error {
+	r := csv.NewReader(input)
+	w := csv.NewWriter(output)
+	if c.delimiter != 0 {
+		r.Comma, w.Comma = c.delimiter, c.delimiter
+	}
+
+	var header []string
+	if !c.noHeader {
+		record, err := r.Read()
+		if err == io.EOF {
+			return ErrEmptyInput
+		}
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for i, h := range record {
+			if h == "" {
+				return fmt.Errorf("csv: column %d has no header", i+1)
+			}
+			if seen[h] {
+				return fmt.Errorf("csv: header %q is duplicated", h)
+			}
+			seen[h] = true
+		}
+		header = record
+		if err := w.Write(header); err != nil {
+			return err
+		}
+	}
+
+	for row := 0; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		columns := header
+		if columns == nil {
+			columns = make([]string, len(record))
+			for i := range record {
+				columns[i] = strconv.Itoa(i)
+			}
+		}
+		values := make(map[string]interface{}, len(record))
+		for i, v := range record {
+			values[columns[i]] = v
+		}
+		key := strconv.Itoa(row)
+		acc, err := accessor.NewAccessor(map[string]interface{}{key: values})
+		if err != nil {
+			return err
+		}
+		if err := fn(acc); err != nil {
+			return fmt.Errorf("csv: row %d: %s", row, err)
+		}
+
+		values, ok := acc.Unwrap().(map[string]interface{})[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("csv: row %d: a row must be a map", row)
+		}
+		for i, col := range columns {
+			s, err := csvString(key+"/"+col, values[col])
+			if err != nil {
+				return err
+			}
+			record[i] = s
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvString(path string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("cannot write %q to csv: nested values are not supported", path)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// parseDelimiter parses the --delimiter flag: a character or "tab".
+func parseDelimiter(delimiter string) (rune, error) {
+	switch delimiter {
+	case "":
+		return ',', nil
+	case "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid delimiter: %q", delimiter)
+	}
+	return r, nil
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVCodec(t *testing.T) {
+	type Input struct {
+		Text      string
+		Delimiter rune
+		NoHeader  bool
+		Pattern   string
+	}
+	type Expect struct {
+		Paths []string
+		Text  string
+		Error string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "header",
+			Input: Input{
+				Text: `name,email,phone
+alice,alice@example.com,"090-1234"
+"bob, jr.",bob@example.com,
+`,
+				Pattern: "email",
+			},
+			Expect: Expect{
+				Paths: []string{"0/name", "0/email", "0/phone", "1/name", "1/email", "1/phone"},
+				Text: `name,email,phone
+alice,ENC[alice@example.com],090-1234
+"bob, jr.",ENC[bob@example.com],
+`,
+			},
+		},
+		{
+			Title: "no header and delimiter",
+			Input: Input{
+				Text:      "alice\t090-1234\nbob\t090-5678\n",
+				Delimiter: '\t',
+				NoHeader:  true,
+				Pattern:   "1",
+			},
+			Expect: Expect{
+				Paths: []string{"0/0", "0/1", "1/0", "1/1"},
+				Text:  "alice\tENC[090-1234]\nbob\tENC[090-5678]\n",
+			},
+		},
+		{
+			Title: "duplicated header",
+			Input: Input{
+				Text: "a,a\n1,2\n",
+			},
+			Expect: Expect{
+				Error: `csv: header "a" is duplicated`,
+			},
+		},
+		{
+			Title: "wrong number of fields",
+			Input: Input{
+				Text: "a,b\n1,2\n3\n",
+			},
+			Expect: Expect{
+				Error: "wrong number of fields",
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var paths []string
+			buf := &bytes.Buffer{}
+			c := csvCodec{delimiter: test.Input.Delimiter, noHeader: test.Input.NoHeader}
+			err := c.process(strings.NewReader(test.Input.Text), buf, func(acc accessor.Accessor) error {
+				var fields []field
+				err := acc.Foreach(func(path accessor.Path, value interface{}) error {
+					p := strings.Trim(path.String(), "/")
+					paths = append(paths, p)
+					if strings.HasSuffix(p, "/"+test.Input.Pattern) {
+						fields = append(fields, field{path, value})
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				for _, f := range fields {
+					if err := acc.Set(f.path, "ENC["+f.value.(string)+"]"); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if test.Expect.Error != "" {
+				if assert.Error(err) {
+					assert.Contains(err.Error(), test.Expect.Error)
+				}
+				return
+			}
+			assert.Nil(err)
+			assert.ElementsMatch(test.Expect.Paths, paths)
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := parseDelimiter(",")
+	assert.Nil(err)
+	assert.Equal(',', d)
+
+	d, err = parseDelimiter("tab")
+	assert.Nil(err)
+	assert.Equal('\t', d)
+
+	d, err = parseDelimiter(";")
+	assert.Nil(err)
+	assert.Equal(';', d)
+
+	_, err = parseDelimiter("::")
+	assert.EqualError(err, `invalid delimiter: "::"`)
+}
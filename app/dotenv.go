@@ -0,0 +1,253 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/morikuni/accessor"
+)
+
+// dotenvCodec reads KEY=value lines of a .env file.
+// each key is a path of the document, and the file is written back
+// with only changed values rewritten.
+type dotenvCodec struct {
+	src     []byte
+	entries map[string]dotenvEntry
+	orig    map[string]interface{}
+}
+
+// dotenvEntry is the location of the definition of a key.
+type dotenvEntry struct {
+	// line is the line number of the key.
+	line int
+	// start and end is the span of the value including quotes.
+	start, end int
+	// lineStart and lineEnd is the span of the whole line including the newline.
+	lineStart, lineEnd int
+	quote              byte
+}
+
+func (c *dotenvCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	obj, entries, err := parseDotenv(bs)
+	if err != nil {
+		return nil, err
+	}
+	orig := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		orig[k] = v
+	}
+	c.src, c.entries, c.orig = bs, entries, orig
+	return accessor.NewAccessor(obj)
+}
+
+func (c *dotenvCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	obj, ok := acc.Unwrap().(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("dotenv document must be a map")
+	}
+
+	var edits []textEdit
+	for k, e := range c.entries {
+		v, ok := obj[k]
+		if !ok {
+			edits = append(edits, textEdit{e.lineStart, e.lineEnd, ""})
+			continue
+		}
+		s, err := dotenvString(k, v)
+		if err != nil {
+			return err
+		}
+		if s != c.orig[k] {
+			edits = append(edits, textEdit{e.start, e.end, formatDotenvValue(s, e.quote)})
+		}
+	}
+	bs, _ := applyEdits(c.src, edits)
+
+	var added []string
+	for k := range obj {
+		if _, ok := c.entries[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	buf := bytes.NewBuffer(bs)
+	for _, k := range added {
+		s, err := dotenvString(k, obj[k])
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "%s=%s\n", k, formatDotenvValue(s, 0))
+	}
+	_, err := output.Write(buf.Bytes())
+	return err
+}
+
+func dotenvString(key string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("cannot write %q to dotenv: nested values are not supported", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// formatDotenvValue formats a value, keeping the quote of the original value if possible.
+func formatDotenvValue(s string, quote byte) string {
+	switch {
+	case quote == '\'' && !strings.ContainsAny(s, "'\n"):
+		return "'" + s + "'"
+	case quote == 0 && !strings.ContainsAny(s, " \t\r\n#'\"\\"):
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func isDotenvKeyByte(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		return true
+	case c >= '0' && c <= '9', c == '.', c == '-':
+		return !first
+	}
+	return false
+}
+
+// parseDotenv parses KEY=value lines.
+// lines may start with "export". values may be quoted by ' or ",
+// and escapes are interpreted only in values quoted by ".
+// comments start with "#" at the start of a line or after a space.
+// a key defined twice is rejected, since only one of the values would be encrypted.
+func parseDotenv(src []byte) (map[string]interface{}, map[string]dotenvEntry, error) {
+	obj := make(map[string]interface{})
+	entries := make(map[string]dotenvEntry)
+	pos, line := 0, 1
+	skipBlank := func() {
+		for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t') {
+			pos++
+		}
+	}
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("dotenv: line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+
+	for pos < len(src) {
+		lineStart := pos
+		skipBlank()
+		if pos >= len(src) || src[pos] == '\n' || src[pos] == '\r' || src[pos] == '#' {
+			for pos < len(src) && src[pos] != '\n' {
+				pos++
+			}
+			pos++
+			line++
+			continue
+		}
+
+		if bytes.HasPrefix(src[pos:], []byte("export")) && pos+6 < len(src) && (src[pos+6] == ' ' || src[pos+6] == '\t') {
+			pos += 6
+			skipBlank()
+		}
+		keyStart := pos
+		for pos < len(src) && isDotenvKeyByte(src[pos], pos == keyStart) {
+			pos++
+		}
+		if keyStart == pos {
+			return nil, nil, errorf("invalid key")
+		}
+		key := string(src[keyStart:pos])
+		if d, ok := entries[key]; ok {
+			return nil, nil, errorf("%q is already defined at line %d", key, d.line)
+		}
+		skipBlank()
+		if pos >= len(src) || src[pos] != '=' {
+			return nil, nil, errorf("%q is not followed by \"=\"", key)
+		}
+		pos++
+		skipBlank()
+
+		e := dotenvEntry{line: line, lineStart: lineStart, start: pos}
+		keyLine := line
+		var value string
+		if pos < len(src) && (src[pos] == '"' || src[pos] == '\'') {
+			e.quote = src[pos]
+			pos++
+			buf := &bytes.Buffer{}
+			closed := false
+			for pos < len(src) && !closed {
+				c := src[pos]
+				switch {
+				case c == e.quote:
+					closed = true
+				case c == '\\' && e.quote == '"' && pos+1 < len(src):
+					pos++
+					switch src[pos] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 'r':
+						buf.WriteByte('\r')
+					case 't':
+						buf.WriteByte('\t')
+					case '"', '\\', '$':
+						buf.WriteByte(src[pos])
+					default:
+						buf.WriteByte('\\')
+						buf.WriteByte(src[pos])
+					}
+				default:
+					if c == '\n' {
+						line++
+					}
+					buf.WriteByte(c)
+				}
+				pos++
+			}
+			if !closed {
+				line = keyLine
+				return nil, nil, errorf("unterminated quote of %q", key)
+			}
+			value, e.end = buf.String(), pos
+		} else {
+			for pos < len(src) && src[pos] != '\n' && src[pos] != '\r' &&
+				!(src[pos] == '#' && (src[pos-1] == ' ' || src[pos-1] == '\t')) {
+				pos++
+			}
+			e.end = pos
+			for e.end > e.start && (src[e.end-1] == ' ' || src[e.end-1] == '\t') {
+				e.end--
+			}
+			value = string(src[e.start:e.end])
+		}
+
+		// the rest of the line may be a comment.
+		skipBlank()
+		if pos < len(src) && src[pos] != '#' && src[pos] != '\n' && src[pos] != '\r' {
+			return nil, nil, errorf("unexpected characters after the value of %q", key)
+		}
+		for pos < len(src) && src[pos] != '\n' {
+			pos++
+		}
+		if pos < len(src) {
+			pos++
+		}
+		e.lineEnd = pos
+		line++
+
+		obj[key] = value
+		entries[key] = e
+	}
+	return obj, entries, nil
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDotenvCodec(t *testing.T) {
+	type Input struct {
+		Text   string
+		Values map[string]interface{}
+	}
+	type Expect struct {
+		Values map[string]interface{}
+		Text   string
+		Error  string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "parse",
+			Input: Input{
+				Text: `# database
+export DB_USER=admin # login user
+DB_PASSWORD = 'se"cr#et'
+DB_URL="postgres://\"db\"\nhost"
+
+EMPTY=
+`,
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"DB_USER":     "admin",
+					"DB_PASSWORD": `se"cr#et`,
+					"DB_URL":      "postgres://\"db\"\nhost",
+					"EMPTY":       "",
+				},
+				Text: `# database
+export DB_USER=admin # login user
+DB_PASSWORD = 'se"cr#et'
+DB_URL="postgres://\"db\"\nhost"
+
+EMPTY=
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `export A=1 # keep me
+B='x'
+C="y"
+D=plain
+`,
+				Values: map[string]interface{}{
+					"A": "ENC[xxx]",
+					"B": "ENC[yyy]",
+					"C": "ENC[zzz]",
+					"D": "two words",
+				},
+			},
+			Expect: Expect{
+				Text: `export A=ENC[xxx] # keep me
+B='ENC[yyy]'
+C="ENC[zzz]"
+D="two words"
+`,
+			},
+		},
+		{
+			Title: "invalid line",
+			Input: Input{
+				Text: `A=1
+B
+`,
+			},
+			Expect: Expect{
+				Error: `dotenv: line 2: "B" is not followed by "="`,
+			},
+		},
+		{
+			Title: "unterminated quote",
+			Input: Input{
+				Text: `A="1
+`,
+			},
+			Expect: Expect{
+				Error: `dotenv: line 1: unterminated quote of "A"`,
+			},
+		},
+		{
+			Title: "duplicate key",
+			Input: Input{
+				Text: `A=1
+B=2
+export A=3
+`,
+			},
+			Expect: Expect{
+				Error: `dotenv: line 3: "A" is already defined at line 1`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("dotenv", codecOptions{}, strings.NewReader(test.Input.Text))
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Values != nil {
+				assert.Equal(test.Expect.Values, acc.Unwrap())
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
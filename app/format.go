@@ -0,0 +1,170 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/morikuni/gipher"
+)
+
+var ErrFormatUndetected = errors.New("cannot detect the format of the input: specify --format")
+
+// formatExtensions maps file extensions to formats.
+var formatExtensions = map[string]string{
+	".txt":        "text",
+	".json":       "json",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".toml":       "toml",
+	".env":        "dotenv",
+	".ini":        "ini",
+	".properties": "properties",
+	".hcl":        "hcl",
+	".tf":         "hcl",
+	".tfvars":     "hcl",
+	".nomad":      "hcl",
+	".xml":        "xml",
+	".ndjson":     "ndjson",
+	".jsonl":      "ndjson",
+	".csv":        "csv",
+}
+
+// sniffSize is the size of the head of the input examined to detect the format.
+const sniffSize = 64 * 1024
+
+// detectFormat detects the format from the extension of the input file, the output file,
+// or the head of the input in this order.
+// the returned reader must be used instead of input, since the head of input is consumed.
+func detectFormat(inputFile, outputFile string, input io.Reader) (string, io.Reader, error) {
+	for _, name := range []string{inputFile, outputFile} {
+		if format := formatOfFile(name); format != "" {
+			return format, input, nil
+		}
+	}
+
+	br := bufio.NewReaderSize(input, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+	format, err := sniffFormat(head, err == io.EOF)
+	if err != nil {
+		return "", nil, err
+	}
+	return format, br, nil
+}
+
+// formatOfFile returns the format of a file by its name, or "" if it is unknown.
+func formatOfFile(name string) string {
+	if name == "" {
+		return ""
+	}
+	base := strings.ToLower(filepath.Base(name))
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return "dotenv"
+	}
+	return formatExtensions[filepath.Ext(base)]
+}
+
+var yamlKeyLine = regexp.MustCompile(`^(- |-$|[^\s=:#"'\[{][^=]*?:(\s|$)|"[^"]*":(\s|$)|'[^']*':(\s|$))`)
+
+// ciphertextLine matches a value encrypted by the text format, with or without the marker.
+var ciphertextLine = regexp.MustCompile(`^(ENC\[.*\]|hex:[0-9a-f]+|base32:[A-Z2-7]+=*|[A-Za-z0-9+/_-]+=*)$`)
+
+// isArmoredStream reports whether head is an armored stream, not an armored value of the text format.
+func isArmoredStream(head []byte) bool {
+	r, err := gipher.NewArmorReader(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	magic := make([]byte, len("GIPHERSTREAM1\n"))
+	n, _ := io.ReadFull(r, magic)
+	return gipher.IsEncryptedStream(magic[:n])
+}
+
+// sniffFormat detects the format from the head of the input.
+// complete reports whether head is the whole input.
+// lines of "key = value" or "[section]" are ambiguous among dotenv, ini, properties, toml, and hcl,
+// and other input which does not look like a structured document is text.
+// a single line of "key: value" is text too, since it may be a sentence,
+// and so is a single line of ciphertext, which the text format writes.
+func sniffFormat(head []byte, complete bool) (string, error) {
+	if gipher.IsEncryptedStream(head) {
+		return "binary", nil
+	}
+	if gipher.IsArmored(head) {
+		if isArmoredStream(head) {
+			return "binary", nil
+		}
+		return "text", nil
+	}
+
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	if len(trimmed) == 0 {
+		return "text", nil
+	}
+	switch trimmed[0] {
+	case '<':
+		return "xml", nil
+	case '{', '[':
+		if complete && json.Valid(trimmed) {
+			return "json", nil
+		}
+		// a line of a value followed by others is a record of ndjson.
+		if i := bytes.IndexByte(trimmed, '\n'); i >= 0 && json.Valid(trimmed[:i]) {
+			return "ndjson", nil
+		}
+		if trimmed[0] == '{' || !complete {
+			return "json", nil
+		}
+	}
+	if bytes.HasPrefix(trimmed, []byte("---")) || bytes.HasPrefix(trimmed, []byte("%YAML")) {
+		return "yaml", nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimRight(line, "\r")
+		l := strings.TrimSpace(line)
+		// the metadata section of yaml is a comment.
+		if strings.HasPrefix(line, yamlMetadataPrefix) {
+			return "yaml", nil
+		}
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "text", nil
+	}
+	if len(lines) == 1 && ciphertextLine.MatchString(strings.TrimSpace(lines[0])) {
+		return "text", nil
+	}
+
+	// the first line which is not a comment tells the format.
+	first := lines[0]
+	if yamlKeyLine.MatchString(first) {
+		keys := 0
+		for _, line := range lines {
+			if yamlKeyLine.MatchString(strings.TrimLeft(line, " ")) {
+				keys++
+			}
+		}
+		if keys > 1 {
+			return "yaml", nil
+		}
+		return "text", nil
+	}
+	l := strings.TrimSpace(first)
+	if strings.HasPrefix(l, "[") || strings.Contains(l, "=") {
+		return "", ErrFormatUndetected
+	}
+	return "text", nil
+}
@@ -0,0 +1,249 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOfFile(t *testing.T) {
+	table := map[string]string{
+		"":                       "",
+		"config.json":            "json",
+		"deploy/app.YML":         "yaml",
+		"Cargo.toml":             "toml",
+		".env":                   "dotenv",
+		".env.production":        "dotenv",
+		"prod.env":               "dotenv",
+		"terraform.tfvars":       "hcl",
+		"settings.xml":           "xml",
+		"audit.jsonl":            "ndjson",
+		"users.csv":              "csv",
+		"secret.bin":             "",
+		"application.properties": "properties",
+	}
+
+	for name, format := range table {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, format, formatOfFile(name))
+		})
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	type Input struct {
+		Text     string
+		Complete bool
+	}
+	type Expect struct {
+		Format string
+		Error  string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title:  "json",
+			Input:  Input{"{\n  \"name\": \"alice\"\n}\n", true},
+			Expect: Expect{Format: "json"},
+		},
+		{
+			Title:  "json array",
+			Input:  Input{"[1, 2]", true},
+			Expect: Expect{Format: "json"},
+		},
+		{
+			Title:  "head of large json",
+			Input:  Input{"{\n  \"name\": ", false},
+			Expect: Expect{Format: "json"},
+		},
+		{
+			Title:  "ndjson",
+			Input:  Input{"{\"name\":\"alice\"}\n{\"name\":\"bob\"}\n", true},
+			Expect: Expect{Format: "ndjson"},
+		},
+		{
+			Title:  "yaml",
+			Input:  Input{"# settings\nname: alice\nage: 18\n", true},
+			Expect: Expect{Format: "yaml"},
+		},
+		{
+			Title:  "yaml stream",
+			Input:  Input{"---\nkind: Secret\n", true},
+			Expect: Expect{Format: "yaml"},
+		},
+		{
+			Title:  "yaml sequence",
+			Input:  Input{"- a\n- b\n", true},
+			Expect: Expect{Format: "yaml"},
+		},
+		{
+			Title:  "xml",
+			Input:  Input{"<?xml version=\"1.0\"?>\n<settings/>\n", true},
+			Expect: Expect{Format: "xml"},
+		},
+		{
+			Title:  "armored stream",
+			Input:  Input{"-----BEGIN GIPHER ENCRYPTED DATA-----\nR0lQSEVSU1RSRUFNMQoAAABA\n", false},
+			Expect: Expect{Format: "binary"},
+		},
+		{
+			Title:  "armored value",
+			Input:  Input{"-----BEGIN GIPHER ENCRYPTED DATA-----\nR1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==\n-----END GIPHER ENCRYPTED DATA-----\n", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "marked ciphertext",
+			Input:  Input{"ENC[R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==]", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "ciphertext",
+			Input:  Input{"R1lyLATIeGJC5UYEGne+KtOr4VzWsn0qeqxjJw==\n", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "base32 ciphertext",
+			Input:  Input{"base32:I5MXELAEZB4GEQXFIYCBU55OFLJ6KXGWWJ6SU6VMMMTQ====", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "sentence",
+			Input:  Input{"Note: call me\n", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "yaml with metadata",
+			Input:  Input{"password: ENC[xxx]\n# gipher: {\"mac\":\"00\"}\n", true},
+			Expect: Expect{Format: "yaml"},
+		},
+		{
+			Title:  "encrypted stream",
+			Input:  Input{"GIPHERSTREAM1\n\x00\x00", false},
+			Expect: Expect{Format: "binary"},
+		},
+		{
+			Title:  "text",
+			Input:  Input{"hello world\n", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "empty",
+			Input:  Input{"", true},
+			Expect: Expect{Format: "text"},
+		},
+		{
+			Title:  "key and value",
+			Input:  Input{"# comment\nPASSWORD=secret\n", true},
+			Expect: Expect{Error: ErrFormatUndetected.Error()},
+		},
+		{
+			Title:  "section",
+			Input:  Input{"[database]\npassword = secret\n", true},
+			Expect: Expect{Error: ErrFormatUndetected.Error()},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			format, err := sniffFormat([]byte(test.Input.Text), test.Input.Complete)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Format, format)
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	format, r, err := detectFormat("", "out.toml", strings.NewReader("a: 1"))
+	assert.Nil(err)
+	assert.Equal("toml", format)
+	bs, err := ioutil.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal("a: 1", string(bs))
+
+	format, _, err = detectFormat("in.txt", "out.toml", strings.NewReader("a: 1"))
+	assert.Nil(err)
+	assert.Equal("text", format)
+
+	format, r, err = detectFormat("", "", strings.NewReader("a: 1\nb: 2"))
+	assert.Nil(err)
+	assert.Equal("yaml", format)
+	bs, err = ioutil.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal("a: 1\nb: 2", string(bs))
+}
+
+func TestDetectFormatRoundTrip(t *testing.T) {
+	type Input struct {
+		Text string
+		Args string
+	}
+	type Test struct {
+		Title string
+		Input Input
+	}
+
+	table := []Test{
+		{
+			Title: "base64",
+			Input: Input{"hello", ""},
+		},
+		{
+			Title: "marked base64",
+			Input: Input{"hello", "--marker"},
+		},
+		{
+			Title: "hex",
+			Input: Input{"hello", "--encoding hex"},
+		},
+		{
+			Title: "base32",
+			Input: Input{"hello", "--encoding base32"},
+		},
+		{
+			Title: "armor",
+			Input: Input{"hello", "--encoding armor"},
+		},
+		{
+			Title: "sentence",
+			Input: Input{"Note: call me", ""},
+		},
+	}
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			encrypted := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			exitCode := NewApp().Run(strings.Fields("gipher encrypt "+test.Input.Args), strings.NewReader(test.Input.Text), encrypted, stderr)
+			assert.Equal(0, exitCode)
+			assert.Equal("", stderr.String())
+
+			decrypted := &bytes.Buffer{}
+			exitCode = NewApp().Run(strings.Fields("gipher decrypt "+test.Input.Args), encrypted, decrypted, stderr)
+			assert.Equal(0, exitCode)
+			assert.Equal("", stderr.String())
+			assert.Equal(test.Input.Text, decrypted.String())
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/morikuni/accessor"
+)
+
+// hclCodec reads an hcl document such as terraform variables or nomad jobs.
+// blocks are maps keyed by their labels (e.g. "job/api/group/web/task/app/env/PASSWORD"),
+// and blocks with the same keys are lists.
+// the document is written back with only literal values rewritten.
+type hclCodec struct {
+	src  []byte
+	orig interface{}
+	// values maps paths of literal values to their spans.
+	values map[string]textSpan
+	// topLevel maps top-level keys to spans of items defining them.
+	topLevel map[string][]textSpan
+}
+
+func (c *hclCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parser.Parse(bs)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("hcl document must be an object")
+	}
+
+	c.src = bs
+	c.values = make(map[string]textSpan)
+	c.topLevel = make(map[string][]textSpan)
+	obj, err := c.object(list, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the accessor modifies obj, so the original values are built separately
+	// along with the locations of them.
+	c.values = make(map[string]textSpan)
+	c.topLevel = make(map[string][]textSpan)
+	c.orig, err = c.object(list, nil)
+	if err != nil {
+		return nil, err
+	}
+	return accessor.NewAccessor(obj)
+}
+
+func hclKey(k *ast.ObjectKey) string {
+	if k.Token.Type == token.STRING {
+		if s, ok := k.Token.Value().(string); ok {
+			return unescapeHCLTemplate(s)
+		}
+	}
+	return k.Token.Text
+}
+
+// unescapeHCLTemplate replaces "$${" and "%%{" by "${" and "%{",
+// which the hcl parser leaves as they are.
+func unescapeHCLTemplate(s string) string {
+	return strings.NewReplacer("$${", "${", "%%{", "%{").Replace(s)
+}
+
+func (c *hclCodec) object(list *ast.ObjectList, path []string) (map[string]interface{}, error) {
+	count := make(map[string]int)
+	for _, item := range list.Items {
+		var keys []string
+		for _, k := range item.Keys {
+			keys = append(keys, hclKey(k))
+		}
+		count[joinPath(keys)]++
+	}
+
+	obj := make(map[string]interface{})
+	index := make(map[string]int)
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return nil, fmt.Errorf("hcl: line %d: item without a key", item.Val.Pos().Line)
+		}
+		var keys []string
+		for _, k := range item.Keys {
+			keys = append(keys, hclKey(k))
+		}
+		full := joinPath(keys)
+		p := append(path[:len(path):len(path)], keys...)
+		repeated := count[full] > 1
+		if repeated {
+			p = append(p, strconv.Itoa(index[full]))
+			index[full]++
+		}
+
+		v, err := c.value(item.Val, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m := obj
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := m[k].(map[string]interface{})
+			if !ok {
+				if _, exists := m[k]; exists {
+					return nil, fmt.Errorf("hcl: line %d: %q is defined twice", item.Pos().Line, k)
+				}
+				child = make(map[string]interface{})
+				m[k] = child
+			}
+			m = child
+		}
+		last := keys[len(keys)-1]
+		switch existing := m[last].(type) {
+		case nil:
+			if repeated {
+				m[last] = []interface{}{v}
+			} else {
+				m[last] = v
+			}
+		case []interface{}:
+			if !repeated {
+				return nil, fmt.Errorf("hcl: line %d: %q is defined twice", item.Pos().Line, last)
+			}
+			m[last] = append(existing, v)
+		case map[string]interface{}:
+			vm, ok := v.(map[string]interface{})
+			if !ok || repeated {
+				return nil, fmt.Errorf("hcl: line %d: %q is defined twice", item.Pos().Line, last)
+			}
+			for k, v := range vm {
+				existing[k] = v
+			}
+		default:
+			return nil, fmt.Errorf("hcl: line %d: %q is defined twice", item.Pos().Line, last)
+		}
+
+		if len(path) == 0 {
+			c.topLevel[keys[0]] = append(c.topLevel[keys[0]], c.itemSpan(item))
+		}
+	}
+	return obj, nil
+}
+
+// itemSpan returns the span of the lines of an item including its comments.
+func (c *hclCodec) itemSpan(item *ast.ObjectItem) textSpan {
+	start := item.Pos().Offset
+	if item.LeadComment != nil {
+		start = item.LeadComment.Pos().Offset
+	}
+	for start > 0 && (c.src[start-1] == ' ' || c.src[start-1] == '\t') {
+		start--
+	}
+
+	var end int
+	switch v := item.Val.(type) {
+	case *ast.LiteralType:
+		end = v.Token.Pos.Offset + len(v.Token.Text)
+	case *ast.ListType:
+		end = v.Rbrack.Offset + 1
+	case *ast.ObjectType:
+		end = v.Rbrace.Offset + 1
+	}
+	for end < len(c.src) && c.src[end] != '\n' {
+		end++
+	}
+	if end < len(c.src) {
+		end++
+	}
+	return textSpan{start, end}
+}
+
+func (c *hclCodec) value(node ast.Node, path []string) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.LiteralType:
+		start := n.Token.Pos.Offset
+		c.values[joinPath(path)] = textSpan{start, start + len(n.Token.Text)}
+		if s, ok := n.Token.Value().(string); ok {
+			return unescapeHCLTemplate(s), nil
+		}
+		return n.Token.Value(), nil
+	case *ast.ListType:
+		list := make([]interface{}, 0, len(n.List))
+		for i, e := range n.List {
+			v, err := c.value(e, append(path[:len(path):len(path)], strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case *ast.ObjectType:
+		return c.object(n.List, path)
+	default:
+		return nil, fmt.Errorf("hcl: line %d: unsupported value", node.Pos().Line)
+	}
+}
+
+func (c *hclCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	var edits []textEdit
+	buf := &bytes.Buffer{}
+	if err := c.diff(nil, c.orig, acc.Unwrap(), &edits, buf); err != nil {
+		return err
+	}
+	bs, ok := applyEdits(c.src, edits)
+	if !ok {
+		return fmt.Errorf("cannot write changes to hcl")
+	}
+	if buf.Len() > 0 {
+		if len(bs) > 0 {
+			if !bytes.HasSuffix(bs, []byte("\n")) {
+				bs = append(bs, '\n')
+			}
+			bs = append(bs, '\n')
+		}
+		bs = append(bs, buf.Bytes()...)
+	}
+	_, err := output.Write(bs)
+	return err
+}
+
+func (c *hclCodec) diff(path []string, orig, value interface{}, edits *[]textEdit, appended *bytes.Buffer) error {
+	switch o := orig.(type) {
+	case map[string]interface{}:
+		vm, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot write %q to hcl: only literal values can be changed", strings.Join(path, "/"))
+		}
+		for k, ov := range o {
+			vv, ok := vm[k]
+			if !ok {
+				if len(path) > 0 {
+					return fmt.Errorf("cannot remove %q from hcl", strings.Join(append(path, k), "/"))
+				}
+				for _, span := range c.topLevel[k] {
+					start := span.start
+					// blank lines before an item removed at the end are removed too,
+					// so that an item appended on encoding is removed cleanly.
+					for span.end == len(c.src) && start >= 2 && c.src[start-1] == '\n' && c.src[start-2] == '\n' {
+						start--
+					}
+					*edits = append(*edits, textEdit{start, span.end, ""})
+				}
+				continue
+			}
+			if err := c.diff(append(path[:len(path):len(path)], k), ov, vv, edits, appended); err != nil {
+				return err
+			}
+		}
+		var added []string
+		for k := range vm {
+			if _, ok := o[k]; !ok {
+				added = append(added, k)
+			}
+		}
+		sort.Strings(added)
+		if len(added) > 0 && len(path) > 0 {
+			return fmt.Errorf("cannot add %q to hcl", strings.Join(append(path, added[0]), "/"))
+		}
+		for _, k := range added {
+			if err := writeHCLItem(appended, k, vm[k], ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		vs, ok := value.([]interface{})
+		if !ok || len(o) != len(vs) {
+			return fmt.Errorf("cannot write %q to hcl: only literal values can be changed", strings.Join(path, "/"))
+		}
+		for i := range o {
+			if err := c.diff(append(path[:len(path):len(path)], strconv.Itoa(i)), o[i], vs[i], edits, appended); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(orig, value) {
+		return nil
+	}
+	span, ok := c.values[joinPath(path)]
+	if !ok {
+		return fmt.Errorf("cannot write %q to hcl: only literal values can be changed", strings.Join(path, "/"))
+	}
+	text, err := formatHCLValue(value)
+	if err != nil {
+		return err
+	}
+	*edits = append(*edits, textEdit{span.start, span.end, text})
+	return nil
+}
+
+func formatHCLValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quoteHCLString(v)
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case []interface{}:
+		var elems []string
+		for _, e := range v {
+			s, err := formatHCLValue(e)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, s)
+		}
+		return "[" + strings.Join(elems, ", ") + "]", nil
+	default:
+		return "", fmt.Errorf("cannot write %T to hcl", v)
+	}
+}
+
+// quoteHCLString quotes s with escapes valid in both hcl 1 and 2,
+// and escapes "${" and "%{" as "$${" and "%%{" so that s is not read as a template.
+func quoteHCLString(s string) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("cannot write invalid utf-8 to hcl")
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(`"`)
+	for i, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '$', '%':
+			buf.WriteRune(r)
+			if strings.HasPrefix(s[i+1:], "{") {
+				buf.WriteRune(r)
+			}
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteString(`"`)
+	// the hcl 1 parser requires braces after "$${" to be balanced.
+	if _, err := parser.Parse(append([]byte("a = "), buf.Bytes()...)); err != nil {
+		return "", fmt.Errorf("cannot write a string to hcl: braces of a template are not balanced")
+	}
+	return buf.String(), nil
+}
+
+func formatHCLKey(k string) (string, error) {
+	for i, r := range k {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.')) {
+			return quoteHCLString(k)
+		}
+	}
+	if k == "" {
+		return `""`, nil
+	}
+	return k, nil
+}
+
+// writeHCLItem writes "k = v", or a block if v is a map.
+func writeHCLItem(buf *bytes.Buffer, k string, v interface{}, indent string) error {
+	key, err := formatHCLKey(k)
+	if err != nil {
+		return err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		s, err := formatHCLValue(v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%s%s = %s\n", indent, key, s)
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(buf, "%s%s {\n", indent, key)
+	for _, k := range keys {
+		if err := writeHCLItem(buf, k, m[k], indent+"  "); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(buf, "%s}\n", indent)
+	return nil
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHCLCodec(t *testing.T) {
+	type Input struct {
+		Text     string
+		Values   map[string]interface{}
+		Metadata map[string]interface{}
+		Strip    bool
+	}
+	type Expect struct {
+		Values map[string]interface{}
+		Text   string
+		Error  string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "parse",
+			Input: Input{
+				Text: `# terraform variables
+db_password = "secret"
+replicas    = 3
+zones       = ["a", "b"]
+`,
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"db_password": "secret",
+					"replicas":    int64(3),
+					"zones":       []interface{}{"a", "b"},
+				},
+				Text: `# terraform variables
+db_password = "secret"
+replicas    = 3
+zones       = ["a", "b"]
+`,
+			},
+		},
+		{
+			Title: "only literal values are rewritten",
+			Input: Input{
+				Text: `job "api" {
+  group "web" {
+    task "app" {
+      env {
+        # database
+        DB_PASSWORD = "secret" // keep me
+        DB_PORT     = 5432
+      }
+    }
+  }
+
+  service {
+    port = "http"
+  }
+
+  service {
+    port = "grpc"
+  }
+}
+`,
+				Values: map[string]interface{}{
+					"job/api/group/web/task/app/env/DB_PASSWORD": "ENC[xxx]",
+					"job/api/group/web/task/app/env/DB_PORT":     "ENC[yyy]",
+					"job/api/service/1/port":                     "ENC[zzz]",
+				},
+			},
+			Expect: Expect{
+				Text: `job "api" {
+  group "web" {
+    task "app" {
+      env {
+        # database
+        DB_PASSWORD = "ENC[xxx]" // keep me
+        DB_PORT     = "ENC[yyy]"
+      }
+    }
+  }
+
+  service {
+    port = "http"
+  }
+
+  service {
+    port = "ENC[zzz]"
+  }
+}
+`,
+			},
+		},
+		{
+			Title: "metadata is appended",
+			Input: Input{
+				Text: `password = "secret"
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `password = "secret"
+
+gipher {
+  version = "1.0"
+}
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `password = "secret"
+
+gipher {
+  version = "1.0"
+}
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `password = "secret"
+`,
+			},
+		},
+		{
+			Title: "escaped templates",
+			Input: Input{
+				Text: `command = "echo $${HOME} %%{if}"
+`,
+				Values: map[string]interface{}{
+					"command": "echo ${PATH}\n",
+				},
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"command": "echo ${HOME} %{if}",
+				},
+				Text: `command = "echo $${PATH}\n"
+`,
+			},
+		},
+		{
+			Title: "nested key cannot be added",
+			Input: Input{
+				Text: `env {
+  A = "1"
+}
+`,
+				Values: map[string]interface{}{
+					"env/B": "2",
+				},
+			},
+			Expect: Expect{
+				Error: `cannot add "env/B" to hcl`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("hcl", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Values != nil {
+				assert.Equal(test.Expect.Values, acc.Unwrap())
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			err = c.encode(buf, acc)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestQuoteHCLString(t *testing.T) {
+	type Input struct {
+		Value string
+	}
+	type Expect struct {
+		Text  string
+		Error string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "plain",
+			Input: Input{
+				Value: "secret",
+			},
+			Expect: Expect{
+				Text: `"secret"`,
+			},
+		},
+		{
+			Title: "quotes and backslashes",
+			Input: Input{
+				Value: `say "C:\"`,
+			},
+			Expect: Expect{
+				Text: `"say \"C:\\\""`,
+			},
+		},
+		{
+			Title: "control characters",
+			Input: Input{
+				Value: "a\x00b\a\tc\r\n",
+			},
+			Expect: Expect{
+				Text: `"a\u0000b\u0007\tc\r\n"`,
+			},
+		},
+		{
+			Title: "templates",
+			Input: Input{
+				Value: "${var.a} %{if x} $ % {}",
+			},
+			Expect: Expect{
+				Text: `"$${var.a} %%{if x} $ % {}"`,
+			},
+		},
+		{
+			Title: "unbalanced template",
+			Input: Input{
+				Value: "a${b",
+			},
+			Expect: Expect{
+				Error: "cannot write a string to hcl: braces of a template are not balanced",
+			},
+		},
+		{
+			Title: "invalid utf-8",
+			Input: Input{
+				Value: "\xff",
+			},
+			Expect: Expect{
+				Error: "cannot write invalid utf-8 to hcl",
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			text, err := quoteHCLString(test.Input.Value)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Text, text)
+
+			acc, _, err := decodeToAccessor("hcl", codecOptions{}, strings.NewReader("a = "+text+"\n"))
+			if !assert.Nil(err) {
+				return
+			}
+			assert.Equal(map[string]interface{}{"a": test.Input.Value}, acc.Unwrap())
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/morikuni/accessor"
+)
+
+// iniCodec reads an ini file.
+// keys in a section are paths like "section/key", and keys before the first section are top-level.
+// the file is written back with only changed values rewritten.
+type iniCodec struct {
+	src      []byte
+	orig     map[string]interface{}
+	entries  []iniEntry
+	sections []iniSection
+	// sep is the separator of the first key, used for added keys.
+	sep string
+	// firstSection is the start of the first section, or the end of the source.
+	firstSection int
+}
+
+type iniEntry struct {
+	section, key string
+	// start and end is the span of the value including quotes.
+	start, end int
+	// lineStart and lineEnd is the span of the whole line including the newline.
+	lineStart, lineEnd int
+	quoted             bool
+}
+
+type iniSection struct {
+	name string
+	// start and end is the span from the header to the next section.
+	start, end int
+	// last is the end of the last line of the section which is not blank or a comment.
+	last int
+}
+
+func (c *iniCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	c.src, c.sep, c.firstSection = bs, " = ", len(bs)
+	obj := make(map[string]interface{})
+	orig := make(map[string]interface{})
+
+	var section *iniSection
+	// sectionValues and sectionOrig are the maps of the current section.
+	var sectionValues, sectionOrig map[string]interface{}
+	pos := 0
+	for line := 1; pos < len(bs); line++ {
+		lineStart := pos
+		for pos < len(bs) && bs[pos] != '\n' {
+			pos++
+		}
+		if pos < len(bs) {
+			pos++
+		}
+		lineEnd := pos
+		text := strings.TrimRight(string(bs[lineStart:lineEnd]), "\r\n")
+		trimmed := strings.TrimSpace(text)
+
+		switch {
+		case trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#':
+			continue
+		case trimmed[0] == '[':
+			end := strings.IndexByte(trimmed, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("ini: line %d: unterminated section", line)
+			}
+			if section != nil {
+				section.end = lineStart
+				c.sections = append(c.sections, *section)
+			} else {
+				c.firstSection = lineStart
+			}
+			name := strings.TrimSpace(trimmed[1:end])
+			section = &iniSection{name: name, start: lineStart, last: lineEnd}
+			if _, ok := obj[name]; !ok {
+				obj[name] = make(map[string]interface{})
+				orig[name] = make(map[string]interface{})
+			}
+			// a section of the same name before is merged, but a global key of the same name is a clash.
+			var ok1, ok2 bool
+			sectionValues, ok1 = obj[name].(map[string]interface{})
+			sectionOrig, ok2 = orig[name].(map[string]interface{})
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("ini: line %d: section %q has the same name as a global key", line, name)
+			}
+			continue
+		}
+
+		i := strings.IndexAny(text, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("ini: line %d: %q has no value", line, trimmed)
+		}
+		key := strings.TrimSpace(text[:i])
+		e := iniEntry{key: key, lineStart: lineStart, lineEnd: lineEnd}
+		e.start = lineStart + i + 1
+		for e.start < lineStart+len(text) && (bs[e.start] == ' ' || bs[e.start] == '\t') {
+			e.start++
+		}
+		e.end = lineStart + len(text)
+		for e.end > e.start && (bs[e.end-1] == ' ' || bs[e.end-1] == '\t') {
+			e.end--
+		}
+		if len(c.entries) == 0 {
+			c.sep = string(bs[lineStart+len(strings.TrimRight(text[:i], " \t")) : e.start])
+		}
+
+		value := string(bs[e.start:e.end])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			e.quoted = true
+			value = unquoteINI(value[1 : len(value)-1])
+		}
+
+		values, origValues := obj, orig
+		if section != nil {
+			e.section = section.name
+			section.last = lineEnd
+			values, origValues = sectionValues, sectionOrig
+		}
+		values[key], origValues[key] = value, value
+		c.entries = append(c.entries, e)
+	}
+	if section != nil {
+		section.end = len(bs)
+		c.sections = append(c.sections, *section)
+	}
+
+	c.orig = orig
+	return accessor.NewAccessor(obj)
+}
+
+func (c *iniCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	obj, ok := acc.Unwrap().(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("ini document must be a map")
+	}
+
+	var edits []textEdit
+	removed := make(map[string]bool)
+	for _, s := range c.sections {
+		if _, ok := obj[s.name].(map[string]interface{}); !ok {
+			if _, ok := obj[s.name]; ok {
+				return fmt.Errorf("cannot write %q to ini: a section must be a map", s.name)
+			}
+			removed[s.name] = true
+			start := s.start
+			// blank lines before a section removed at the end are removed too,
+			// so that a section appended on encoding is removed cleanly.
+			for s.end == len(c.src) && start >= 2 && c.src[start-1] == '\n' && c.src[start-2] == '\n' {
+				start--
+			}
+			edits = append(edits, textEdit{start, s.end, ""})
+		}
+	}
+
+	for _, e := range c.entries {
+		if removed[e.section] {
+			continue
+		}
+		values, origValues := obj, c.orig
+		if e.section != "" {
+			var err error
+			values, origValues, err = c.sectionMaps(obj, e.section)
+			if err != nil {
+				return err
+			}
+		}
+		v, ok := values[e.key]
+		if !ok {
+			edits = append(edits, textEdit{e.lineStart, e.lineEnd, ""})
+			continue
+		}
+		s, err := iniString(e.key, v)
+		if err != nil {
+			return err
+		}
+		if s != origValues[e.key] {
+			edits = append(edits, textEdit{e.start, e.end, formatINIValue(s, e.quoted)})
+		}
+	}
+
+	// keys added to existing sections are written after the last key of the section.
+	added := make(map[string]bool)
+	for i := len(c.sections) - 1; i >= 0; i-- {
+		s := c.sections[i]
+		if removed[s.name] || added[s.name] {
+			continue
+		}
+		added[s.name] = true
+		values, origValues, err := c.sectionMaps(obj, s.name)
+		if err != nil {
+			return err
+		}
+		text, err := c.addedKeys(values, origValues)
+		if err != nil {
+			return err
+		}
+		if text != "" {
+			edits = append(edits, textEdit{s.last, s.last, c.newline(s.last) + text})
+		}
+	}
+
+	sections := make(map[string]map[string]interface{})
+	globalValues := make(map[string]interface{})
+	for k, v := range obj {
+		if _, ok := c.orig[k]; ok {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			sections[k] = m
+			continue
+		}
+		globalValues[k] = v
+	}
+	global, err := c.addedKeys(globalValues, nil)
+	if err != nil {
+		return err
+	}
+	if global != "" {
+		edits = append(edits, textEdit{c.firstSection, c.firstSection, c.newline(c.firstSection) + global})
+	}
+
+	bs, _ := applyEdits(c.src, edits)
+	buf := bytes.NewBuffer(bs)
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		text, err := c.addedKeys(sections[name], nil)
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 0 {
+			if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "[%s]\n%s", name, text)
+	}
+
+	_, err = output.Write(buf.Bytes())
+	return err
+}
+
+// sectionMaps returns the values of a section in obj and the original values of it.
+func (c *iniCodec) sectionMaps(obj map[string]interface{}, name string) (map[string]interface{}, map[string]interface{}, error) {
+	values, ok := obj[name].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot write %q to ini: a section must be a map", name)
+	}
+	origValues, ok := c.orig[name].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot write %q to ini: a global key cannot become a section", name)
+	}
+	return values, origValues, nil
+}
+
+// newline returns a newline if the source does not end with a newline just before pos.
+func (c *iniCodec) newline(pos int) string {
+	if pos > 0 && c.src[pos-1] != '\n' {
+		return "\n"
+	}
+	return ""
+}
+
+// addedKeys returns lines of keys in values which are not in orig.
+func (c *iniCodec) addedKeys(values, orig map[string]interface{}) (string, error) {
+	var keys []string
+	for k := range values {
+		if _, ok := orig[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	buf := &bytes.Buffer{}
+	for _, k := range keys {
+		s, err := iniString(k, values[k])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "%s%s%s\n", k, c.sep, formatINIValue(s, false))
+	}
+	return buf.String(), nil
+}
+
+func iniString(key string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("cannot write %q to ini: nested values are not supported", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+var (
+	iniQuoter   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	iniUnquoter = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+)
+
+// formatINIValue formats a value, quoting it if it was quoted or if it cannot be written as is.
+func formatINIValue(s string, quoted bool) string {
+	if !quoted && s == strings.TrimSpace(s) && !strings.ContainsAny(s, "\r\n") &&
+		!strings.HasPrefix(s, ";") && !strings.HasPrefix(s, "#") && !strings.HasPrefix(s, `"`) {
+		return s
+	}
+	return `"` + iniQuoter.Replace(s) + `"`
+}
+
+func unquoteINI(s string) string {
+	return iniUnquoter.Replace(s)
+}
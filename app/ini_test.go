@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestINICodec(t *testing.T) {
+	type Input struct {
+		Text     string
+		Values   map[string]interface{}
+		Metadata map[string]interface{}
+		Strip    bool
+	}
+	type Expect struct {
+		Values map[string]interface{}
+		Text   string
+		Error  string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "parse",
+			Input: Input{
+				Text: `; global settings
+name = api
+
+[database]
+user: admin
+password = "se\"cret "
+`,
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"name": "api",
+					"database": map[string]interface{}{
+						"user":     "admin",
+						"password": `se"cret `,
+					},
+				},
+				Text: `; global settings
+name = api
+
+[database]
+user: admin
+password = "se\"cret "
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `[database]
+# the password
+password = secret
+user = "admin"
+
+[cache]
+password=x
+`,
+				Values: map[string]interface{}{
+					"database/password": "ENC[xxx]",
+					"database/user":     "ENC[yyy]",
+					"database/port":     "5432",
+					"cache/password":    " spaced",
+				},
+			},
+			Expect: Expect{
+				Text: `[database]
+# the password
+password = ENC[xxx]
+user = "ENC[yyy]"
+port = 5432
+
+[cache]
+password=" spaced"
+`,
+			},
+		},
+		{
+			Title: "metadata is appended",
+			Input: Input{
+				Text: `[database]
+password = secret
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `[database]
+password = secret
+
+[gipher]
+version = 1.0
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `[database]
+password = secret
+
+[gipher]
+version = 1.0
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `[database]
+password = secret
+`,
+			},
+		},
+		{
+			Title: "no value",
+			Input: Input{
+				Text: `[database]
+password
+`,
+			},
+			Expect: Expect{
+				Error: `ini: line 2: "password" has no value`,
+			},
+		},
+		{
+			Title: "section clashes with a global key",
+			Input: Input{
+				Text: `db = x
+[db]
+user = a
+`,
+			},
+			Expect: Expect{
+				Error: `ini: line 2: section "db" has the same name as a global key`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("ini", codecOptions{}, strings.NewReader(test.Input.Text))
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Values != nil {
+				assert.Equal(test.Expect.Values, acc.Unwrap())
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
@@ -28,7 +28,7 @@ func createIO(stdin io.Reader, stdout io.Writer, inputFile, outputFile string) (
 
 	output := newNopCloser(stdout)
 	if outputFile != "" {
-		f, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE, 0644)
+		f, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
 			input.Close()
 			return nil, nil, err
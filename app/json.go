@@ -0,0 +1,361 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/morikuni/accessor"
+)
+
+// jsonCodec keeps the source of the document,
+// so that key order and whitespace are reproduced and only changed values are rewritten on encoding.
+// if indent is set, the output is indented by it instead of the original whitespace.
+type jsonCodec struct {
+	indent string
+	src    []byte
+	root   *jsonNode
+}
+
+func (c *jsonCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	err = json.NewDecoder(bytes.NewReader(bs)).Decode(&obj)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrEmptyInput
+		}
+		return nil, err
+	}
+	root, err := scanJSON(bs)
+	if err != nil {
+		return nil, err
+	}
+	c.src, c.root = bs, root
+	return accessor.NewAccessor(obj)
+}
+
+func (c *jsonCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	if c.root == nil {
+		return json.NewEncoder(output).Encode(acc.Unwrap())
+	}
+
+	value, err := c.root.render(c.src, acc.Unwrap())
+	if err != nil {
+		return err
+	}
+	if c.indent != "" {
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, value); err != nil {
+			return err
+		}
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, buf.Bytes(), "", c.indent); err != nil {
+			return err
+		}
+		indented.WriteString("\n")
+		_, err = output.Write(indented.Bytes())
+		return err
+	}
+
+	bs := make([]byte, 0, len(c.src))
+	bs = append(bs, c.src[:c.root.start]...)
+	bs = append(bs, value...)
+	bs = append(bs, c.src[c.root.end:]...)
+	_, err = output.Write(bs)
+	return err
+}
+
+// parseIndent parses the --indent flag: a number of spaces or "tab".
+func parseIndent(indent string) (string, error) {
+	switch indent {
+	case "":
+		return "", nil
+	case "tab":
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(indent)
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("invalid indent: %q", indent)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// jsonNode is the location of a value in the source.
+type jsonNode struct {
+	start, end int
+	members    []jsonMember // for objects
+	elems      []*jsonNode  // for arrays
+	kind       byte         // '{', '[' or 0 for scalars
+}
+
+type jsonMember struct {
+	key              string
+	keyStart, keyEnd int
+	value            *jsonNode
+}
+
+// render returns the source of the node updated to represent value.
+func (n *jsonNode) render(src []byte, value interface{}) ([]byte, error) {
+	switch n.kind {
+	case '{':
+		if m, ok := value.(map[string]interface{}); ok {
+			return n.renderObject(src, m)
+		}
+	case '[':
+		if a, ok := value.([]interface{}); ok && len(a) == len(n.elems) {
+			return n.renderArray(src, a)
+		}
+	default:
+		var old interface{}
+		if err := json.Unmarshal(src[n.start:n.end], &old); err == nil && reflect.DeepEqual(old, value) {
+			return src[n.start:n.end], nil
+		}
+	}
+	return json.Marshal(value)
+}
+
+func (n *jsonNode) renderArray(src []byte, value []interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	pos := n.start
+	for i, e := range n.elems {
+		buf.Write(src[pos:e.start])
+		bs, err := e.render(src, value[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bs)
+		pos = e.end
+	}
+	buf.Write(src[pos:n.end])
+	return buf.Bytes(), nil
+}
+
+func (n *jsonNode) renderObject(src []byte, value map[string]interface{}) ([]byte, error) {
+	var kept []jsonMember
+	present := make(map[string]bool)
+	for _, m := range n.members {
+		if _, ok := value[m.key]; ok && !present[m.key] {
+			kept = append(kept, m)
+			present[m.key] = true
+		}
+	}
+	var added []string
+	for k := range value {
+		if !present[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+
+	buf := &bytes.Buffer{}
+	if len(kept) == len(n.members) && len(added) == 0 {
+		pos := n.start
+		for _, m := range n.members {
+			buf.Write(src[pos:m.value.start])
+			bs, err := m.value.render(src, value[m.key])
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(bs)
+			pos = m.value.end
+		}
+		buf.Write(src[pos:n.end])
+		return buf.Bytes(), nil
+	}
+
+	// members are added or removed. the object is rebuilt with
+	// whitespace taken from the original members.
+	lead, sep, colon, trail := "", ",", ":", ""
+	if len(n.members) > 0 {
+		first, last := n.members[0], n.members[len(n.members)-1]
+		lead = string(src[n.start+1 : first.keyStart])
+		sep = "," + lead
+		if len(n.members) > 1 {
+			sep = string(src[first.value.end:n.members[1].keyStart])
+		}
+		colon = string(src[first.keyEnd:first.value.start])
+		trail = string(src[last.value.end : n.end-1])
+	}
+
+	buf.WriteString("{")
+	if len(kept)+len(added) > 0 {
+		buf.WriteString(lead)
+	}
+	for i, m := range kept {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		buf.Write(src[m.keyStart:m.value.start])
+		bs, err := m.value.render(src, value[m.key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bs)
+	}
+	for i, k := range added {
+		if i > 0 || len(kept) > 0 {
+			buf.WriteString(sep)
+		}
+		bs, err := json.Marshal(value[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(mustMarshalJSON(k))
+		buf.WriteString(colon)
+		buf.Write(bs)
+	}
+	if len(kept)+len(added) > 0 {
+		buf.WriteString(trail)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+func mustMarshalJSON(s string) []byte {
+	bs, _ := json.Marshal(s)
+	return bs
+}
+
+// scanJSON returns the location of the first value in src.
+// src must be valid json, checked by encoding/json beforehand.
+func scanJSON(src []byte) (*jsonNode, error) {
+	s := &jsonScanner{src: src}
+	s.skipSpace()
+	return s.value()
+}
+
+type jsonScanner struct {
+	src []byte
+	pos int
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsonScanner) errorf() error {
+	return fmt.Errorf("unexpected json at offset %d", s.pos)
+}
+
+func (s *jsonScanner) value() (*jsonNode, error) {
+	if s.pos >= len(s.src) {
+		return nil, s.errorf()
+	}
+	switch s.src[s.pos] {
+	case '{':
+		return s.object()
+	case '[':
+		return s.array()
+	case '"':
+		start := s.pos
+		if err := s.str(); err != nil {
+			return nil, err
+		}
+		return &jsonNode{start: start, end: s.pos}, nil
+	default:
+		start := s.pos
+		for s.pos < len(s.src) && !strings.ContainsRune(" \t\r\n,]}", rune(s.src[s.pos])) {
+			s.pos++
+		}
+		return &jsonNode{start: start, end: s.pos}, nil
+	}
+}
+
+func (s *jsonScanner) str() error {
+	s.pos++
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '\\':
+			s.pos += 2
+		case '"':
+			s.pos++
+			return nil
+		default:
+			s.pos++
+		}
+	}
+	return s.errorf()
+}
+
+func (s *jsonScanner) object() (*jsonNode, error) {
+	n := &jsonNode{start: s.pos, kind: '{'}
+	s.pos++
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.src) {
+			return nil, s.errorf()
+		}
+		switch s.src[s.pos] {
+		case '}':
+			s.pos++
+			n.end = s.pos
+			return n, nil
+		case ',':
+			s.pos++
+			continue
+		}
+
+		keyStart := s.pos
+		if err := s.str(); err != nil {
+			return nil, err
+		}
+		keyEnd := s.pos
+		var key string
+		if err := json.Unmarshal(s.src[keyStart:keyEnd], &key); err != nil {
+			return nil, err
+		}
+		s.skipSpace()
+		if s.pos >= len(s.src) || s.src[s.pos] != ':' {
+			return nil, s.errorf()
+		}
+		s.pos++
+		s.skipSpace()
+		v, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		n.members = append(n.members, jsonMember{key, keyStart, keyEnd, v})
+	}
+}
+
+func (s *jsonScanner) array() (*jsonNode, error) {
+	n := &jsonNode{start: s.pos, kind: '['}
+	s.pos++
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.src) {
+			return nil, s.errorf()
+		}
+		switch s.src[s.pos] {
+		case ']':
+			s.pos++
+			n.end = s.pos
+			return n, nil
+		case ',':
+			s.pos++
+			continue
+		}
+		v, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		n.elems = append(n.elems, v)
+	}
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONCodec(t *testing.T) {
+	type Input struct {
+		Text     string
+		Indent   string
+		Values   map[string]interface{}
+		Metadata map[string]interface{}
+		Strip    bool
+	}
+	type Expect struct {
+		Text string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "nothing changed",
+			Input: Input{
+				Text: `{
+    "zebra": 1,
+    "apple": {"b": true,   "a": null},
+    "list": [ 1.50, "x" ]
+}
+`,
+			},
+			Expect: Expect{
+				Text: `{
+    "zebra": 1,
+    "apple": {"b": true,   "a": null},
+    "list": [ 1.50, "x" ]
+}
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `{
+	"zebra": 1,
+	"password": "secret",
+	"apple": ["a", "b"]
+}`,
+				Values: map[string]interface{}{
+					"password": "ENC[xxx]",
+					"apple/1":  "c",
+				},
+			},
+			Expect: Expect{
+				Text: `{
+	"zebra": 1,
+	"password": "ENC[xxx]",
+	"apple": ["a", "c"]
+}`,
+			},
+		},
+		{
+			Title: "type is changed",
+			Input: Input{
+				Text: `{"age": "aW50OjE4", "name": "Alice"}`,
+				Values: map[string]interface{}{
+					"age": int64(18),
+				},
+			},
+			Expect: Expect{
+				Text: `{"age": 18, "name": "Alice"}`,
+			},
+		},
+		{
+			Title: "metadata is appended",
+			Input: Input{
+				Text: `{
+  "name": "Alice",
+  "age": 18
+}
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `{
+  "name": "Alice",
+  "age": 18,
+  "gipher": {"version":"1.0"}
+}
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `{
+  "gipher": {"version": "1.0"},
+  "name": "Alice",
+  "age": 18
+}
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `{
+  "name": "Alice",
+  "age": 18
+}
+`,
+			},
+		},
+		{
+			Title: "indent",
+			Input: Input{
+				Text:   `{"zebra": 1, "apple": [true]}`,
+				Indent: "  ",
+			},
+			Expect: Expect{
+				Text: `{
+  "zebra": 1,
+  "apple": [
+    true
+  ]
+}
+`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("json", codecOptions{indent: test.Input.Indent}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestParseIndent(t *testing.T) {
+	assert := assert.New(t)
+
+	indent, err := parseIndent("")
+	assert.Nil(err)
+	assert.Equal("", indent)
+
+	indent, err = parseIndent("4")
+	assert.Nil(err)
+	assert.Equal("    ", indent)
+
+	indent, err = parseIndent("tab")
+	assert.Nil(err)
+	assert.Equal("\t", indent)
+
+	_, err = parseIndent("wide")
+	assert.EqualError(err, `invalid indent: "wide"`)
+}
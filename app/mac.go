@@ -0,0 +1,178 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/morikuni/accessor"
+	"github.com/morikuni/gipher"
+)
+
+var (
+	ErrMACMissing  = errors.New("mac is missing in the document")
+	ErrMACMismatch = errors.New("mac does not match. the document may have been tampered with")
+)
+
+const (
+	macField    = "mac"
+	macKeyField = "mac_key"
+)
+
+// canonicalizeDocument returns a serialization of the document which does not depend on the order of fields.
+// every key and scalar is prefixed by its length and every container by its type and size,
+// so that different documents, e.g. {"a/b": 1} and {"a": {"b": 1}}, never share a serialization.
+// excluded are fields of the metadata section left out of the serialization.
+func canonicalizeDocument(acc accessor.Accessor, excluded ...string) []byte {
+	buf := &bytes.Buffer{}
+	writeCanonical(buf, acc.Unwrap(), func(keys []string) bool {
+		if len(keys) != 2 || keys[0] != MetadataKey {
+			return false
+		}
+		for _, f := range excluded {
+			if keys[1] == f {
+				return true
+			}
+		}
+		return false
+	}, nil)
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, value interface{}, skip func(keys []string) bool, keys []string) {
+	var m map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m = v
+	case map[interface{}]interface{}:
+		m = make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = e
+		}
+	case []interface{}:
+		fmt.Fprintf(buf, "a%d:", len(v))
+		for i, e := range v {
+			writeCanonical(buf, e, skip, append(keys[:len(keys):len(keys)], strconv.Itoa(i)))
+		}
+		return
+	default:
+		s, ok := encodeToString(value)
+		if !ok {
+			s = fmt.Sprintf("%T:%v", value, value)
+		}
+		fmt.Fprintf(buf, "s%d:%s", len(s), s)
+		return
+	}
+
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		if !skip(append(keys, k)) {
+			ks = append(ks, k)
+		}
+	}
+	sort.Strings(ks)
+	fmt.Fprintf(buf, "m%d:", len(ks))
+	for _, k := range ks {
+		fmt.Fprintf(buf, "%d:%s", len(k), k)
+		writeCanonical(buf, m[k], skip, append(keys[:len(keys):len(keys)], k))
+	}
+}
+
+// computeMAC returns HMAC-SHA256 of the canonicalized document.
+// the metadata section is covered except the mac itself and the signature added after it.
+func computeMAC(key []byte, acc accessor.Accessor) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(canonicalizeDocument(acc, macField, macKeyField, signatureField, signingKeyField))
+	return mac.Sum(nil)
+}
+
+// sealMACKey encrypts the key of the mac as a stream,
+// so that the key is authenticated even if cryptor itself does not authenticate ciphertexts.
+func sealMACKey(cryptor gipher.Cryptor, key []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	w, err := gipher.NewEncryptWriter(buf, cryptor)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(key); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return string(gipher.EncodeCiphertext(buf.Bytes())), nil
+}
+
+// openMACKey decrypts the key sealed by sealMACKey.
+func openMACKey(cryptor gipher.Cryptor, sealed string) ([]byte, error) {
+	bs, err := gipher.DecodeCiphertext(gipher.Ciphertext(sealed))
+	if err != nil {
+		return nil, err
+	}
+	r, err := gipher.NewDecryptReader(bytes.NewReader(bs), cryptor)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// addMAC stores the mac of the document in the metadata section.
+// the key of the mac is sealed by cryptor and stored with the mac.
+func addMAC(cryptor gipher.Cryptor, acc accessor.Accessor) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	sealedKey, err := sealMACKey(cryptor, key)
+	if err != nil {
+		return err
+	}
+
+	// the section is created before the mac is computed, because the mac covers it.
+	md := getMetadata(acc)
+	if md == nil {
+		md = make(map[string]interface{})
+	}
+	md[macKeyField] = sealedKey
+	if err := setMetadata(acc, md); err != nil {
+		return err
+	}
+	md[macField] = hex.EncodeToString(computeMAC(key, acc))
+	return setMetadata(acc, md)
+}
+
+// hasMAC reports whether the document has a mac.
+func hasMAC(acc accessor.Accessor) bool {
+	_, ok := getMetadata(acc)[macField]
+	return ok
+}
+
+// verifyMAC checks the mac stored by addMAC.
+func verifyMAC(cryptor gipher.Cryptor, acc accessor.Accessor) error {
+	md := getMetadata(acc)
+	macHex, ok1 := md[macField].(string)
+	sealedKey, ok2 := md[macKeyField].(string)
+	if !ok1 || !ok2 {
+		return ErrMACMissing
+	}
+	expected, err := hex.DecodeString(macHex)
+	if err != nil {
+		return ErrMACMismatch
+	}
+	key, err := openMACKey(cryptor, sealedKey)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt the mac key: %s", err)
+	}
+	if !hmac.Equal(computeMAC(key, acc), expected) {
+		return ErrMACMismatch
+	}
+	return nil
+}
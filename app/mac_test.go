@@ -0,0 +1,216 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/morikuni/gipher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMAC(t *testing.T) {
+	type Input struct {
+		Tamper func(obj map[string]interface{})
+	}
+	type Expect struct {
+		Err error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "not tampered",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {},
+			},
+			Expect: Expect{
+				Err: nil,
+			},
+		},
+		{
+			Title: "key deleted",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					delete(obj, "password")
+				},
+			},
+			Expect: Expect{
+				Err: ErrMACMismatch,
+			},
+		},
+		{
+			Title: "key added",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					obj["admin"] = true
+				},
+			},
+			Expect: Expect{
+				Err: ErrMACMismatch,
+			},
+		},
+		{
+			Title: "value changed",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					obj["user"].(map[string]interface{})["name"] = "Bob"
+				},
+			},
+			Expect: Expect{
+				Err: ErrMACMismatch,
+			},
+		},
+		{
+			Title: "metadata added",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					obj[MetadataKey].(map[string]interface{})["pattern"] = "^$"
+				},
+			},
+			Expect: Expect{
+				Err: ErrMACMismatch,
+			},
+		},
+		{
+			Title: "signature added",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					obj[MetadataKey].(map[string]interface{})[signatureField] = "signature"
+				},
+			},
+			Expect: Expect{
+				Err: nil,
+			},
+		},
+		{
+			Title: "mac deleted",
+			Input: Input{
+				Tamper: func(obj map[string]interface{}) {
+					delete(obj[MetadataKey].(map[string]interface{}), macField)
+				},
+			},
+			Expect: Expect{
+				Err: ErrMACMissing,
+			},
+		},
+	}
+
+	cryptor := gipher.NewPasswordCryptor([]byte("password"))
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			obj := map[string]interface{}{
+				"password": "encrypted",
+				"user": map[string]interface{}{
+					"name": "Alice",
+					"age":  float64(18),
+				},
+			}
+			acc, err := accessor.NewAccessor(obj)
+			assert.Nil(err)
+			assert.Nil(addMAC(cryptor, acc))
+			assert.True(hasMAC(acc))
+
+			test.Input.Tamper(acc.Unwrap().(map[string]interface{}))
+
+			assert.Equal(test.Expect.Err, verifyMAC(cryptor, acc))
+		})
+	}
+}
+
+func TestCanonicalizeDocument(t *testing.T) {
+	type Input struct {
+		A interface{}
+		B interface{}
+	}
+	type Expect struct {
+		Equal bool
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "order of keys",
+			Input: Input{
+				A: map[string]interface{}{"a": "x", "b": "y"},
+				B: map[interface{}]interface{}{"b": "y", "a": "x"},
+			},
+			Expect: Expect{
+				Equal: true,
+			},
+		},
+		{
+			Title: "slash in key",
+			Input: Input{
+				A: map[string]interface{}{"a/b": "x"},
+				B: map[string]interface{}{"a": map[string]interface{}{"b": "x"}},
+			},
+			Expect: Expect{
+				Equal: false,
+			},
+		},
+		{
+			Title: "map and array",
+			Input: Input{
+				A: map[string]interface{}{"a": map[string]interface{}{"0": "x"}},
+				B: map[string]interface{}{"a": []interface{}{"x"}},
+			},
+			Expect: Expect{
+				Equal: false,
+			},
+		},
+		{
+			Title: "empty map",
+			Input: Input{
+				A: map[string]interface{}{"a": "x", "b": map[string]interface{}{}},
+				B: map[string]interface{}{"a": "x"},
+			},
+			Expect: Expect{
+				Equal: false,
+			},
+		},
+		{
+			Title: "empty array",
+			Input: Input{
+				A: map[string]interface{}{"a": "x", "b": []interface{}{}},
+				B: map[string]interface{}{"a": "x", "b": map[string]interface{}{}},
+			},
+			Expect: Expect{
+				Equal: false,
+			},
+		},
+		{
+			Title: "separator in value",
+			Input: Input{
+				A: map[string]interface{}{"a": "x\x00b", "b": "y"},
+				B: map[string]interface{}{"a": "x", "b\x00b": "y"},
+			},
+			Expect: Expect{
+				Equal: false,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			a, err := accessor.NewAccessor(test.Input.A)
+			assert.Nil(err)
+			b, err := accessor.NewAccessor(test.Input.B)
+			assert.Nil(err)
+
+			assert.Equal(test.Expect.Equal, string(canonicalizeDocument(a)) == string(canonicalizeDocument(b)))
+		})
+	}
+}
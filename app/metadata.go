@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/morikuni/accessor"
+	"github.com/spf13/pflag"
+)
+
+// Version is the version of gipher recorded in the metadata section.
+var Version = "unknown"
+
+const versionField = "version"
+
+// metadataFlags maps fields of the metadata section to flags they are read from on encryption
+// and written to on decryption.
+// fields needed to create the cryptor are read only if --metadata is given on decryption,
+// since they are read before the mac is verified. the others are read after it.
+var metadataFlags = []struct {
+	field   string
+	flag    string
+	cryptor bool
+}{
+	{"cryptor", "cryptor", true},
+	{"aws_region", "aws-region", true},
+	{"aws_key_id", "aws-key-id", true},
+	{"pattern", "pattern", false},
+	{"marker", "marker", false},
+	{"encoding", "encoding", false},
+	{"compress", "compress", false},
+	{"padding", "padding", false},
+}
+
+// MetadataKey is the top-level key of the section where gipher stores data about the document.
+// fields in the section are never encrypted/decrypted.
+const MetadataKey = "gipher"
+
+var ErrMetadataNotSupported = errors.New("the document must be a map to store metadata")
+
+// isMetadataPath reports whether path points into the metadata section.
+func isMetadataPath(path accessor.Path) bool {
+	p := strings.Trim(path.String(), "/")
+	return p == MetadataKey || strings.HasPrefix(p, MetadataKey+"/")
+}
+
+// metadataFormats are formats which can hold the metadata section.
+// the other formats are flat or have no keys.
+var metadataFormats = map[string]bool{
+	"json": true,
+	"yaml": true,
+	"toml": true,
+	"ini":  true,
+	"hcl":  true,
+	"xml":  true,
+}
+
+// canStoreMetadata reports whether the metadata section can be stored in the document of format.
+func canStoreMetadata(format string, acc accessor.Accessor) bool {
+	if !metadataFormats[format] {
+		return false
+	}
+	switch acc.Unwrap().(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// getMetadata returns the metadata section of the document, or nil if it does not exist.
+func getMetadata(acc accessor.Accessor) map[string]interface{} {
+	path, err := accessor.ParsePath(MetadataKey)
+	if err != nil {
+		return nil
+	}
+	md, err := acc.Get(path)
+	if err != nil {
+		return nil
+	}
+	switch m := md.Unwrap().(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		r := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			r[fmt.Sprint(k)] = v
+		}
+		return r
+	default:
+		return nil
+	}
+}
+
+// setMetadata replaces the metadata section of the document.
+func setMetadata(acc accessor.Accessor, md map[string]interface{}) error {
+	switch acc.Unwrap().(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		return ErrMetadataNotSupported
+	}
+	path, err := accessor.ParsePath(MetadataKey)
+	if err != nil {
+		return err
+	}
+	return acc.Set(path, md)
+}
+
+// withoutMetadata returns the document without the metadata section.
+// the document is not modified.
+func withoutMetadata(obj interface{}) interface{} {
+	switch m := obj.(type) {
+	case map[string]interface{}:
+		if _, ok := m[MetadataKey]; !ok {
+			return obj
+		}
+		r := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if k != MetadataKey {
+				r[k] = v
+			}
+		}
+		return r
+	case map[interface{}]interface{}:
+		if _, ok := m[MetadataKey]; !ok {
+			return obj
+		}
+		r := make(map[interface{}]interface{}, len(m))
+		for k, v := range m {
+			if k != MetadataKey {
+				r[k] = v
+			}
+		}
+		return r
+	default:
+		return obj
+	}
+}
+
+// writeFlagsToMetadata records the version and the flags needed for decryption in the metadata section.
+func writeFlagsToMetadata(acc accessor.Accessor, flag *pflag.FlagSet) error {
+	md := getMetadata(acc)
+	if md == nil {
+		md = make(map[string]interface{})
+	}
+	md[versionField] = Version
+	for _, mf := range metadataFlags {
+		f := flag.Lookup(mf.flag)
+		if f == nil {
+			continue
+		}
+		if v := f.Value.String(); v != "" {
+			md[mf.field] = v
+		} else {
+			delete(md, mf.field)
+		}
+	}
+	return setMetadata(acc, md)
+}
+
+// readFlagsFromMetadata sets flags not given explicitly from the metadata section.
+// if cryptor is true, only flags needed to create the cryptor are set, otherwise only the others are set.
+func readFlagsFromMetadata(acc accessor.Accessor, flag *pflag.FlagSet, cryptor bool) error {
+	md := getMetadata(acc)
+	for _, mf := range metadataFlags {
+		if mf.cryptor != cryptor {
+			continue
+		}
+		v, ok := md[mf.field]
+		if !ok || flag.Changed(mf.flag) {
+			continue
+		}
+		if err := flag.Set(mf.flag, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("invalid metadata %q: %s", mf.field, err)
+		}
+	}
+	return nil
+}
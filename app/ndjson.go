@@ -0,0 +1,53 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/morikuni/accessor"
+)
+
+// ndjsonCodec reads newline delimited json, a json value per line.
+// each record is written back as soon as it is processed, keeping its layout like jsonCodec,
+// so that the memory does not grow with the input.
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) process(input io.Reader, output io.Writer, fn func(acc accessor.Accessor) error) error {
+	r := bufio.NewReader(input)
+	w := bufio.NewWriter(output)
+	for line := 1; ; line++ {
+		bs, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(bs) == 0 {
+			break
+		}
+		record := bytes.TrimRight(bs, "\r\n")
+		newline := bs[len(record):]
+		if len(bytes.TrimSpace(record)) == 0 {
+			if _, err := w.Write(bs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		c := &jsonCodec{}
+		acc, err := c.decode(bytes.NewReader(record))
+		if err != nil {
+			return fmt.Errorf("ndjson: line %d: %s", line, err)
+		}
+		if err := fn(acc); err != nil {
+			return fmt.Errorf("ndjson: line %d: %s", line, err)
+		}
+		if err := c.encode(w, acc); err != nil {
+			return fmt.Errorf("ndjson: line %d: %s", line, err)
+		}
+		if _, err := w.Write(newline); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONCodec(t *testing.T) {
+	type Input struct {
+		Text string
+	}
+	type Expect struct {
+		Text  string
+		Error string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "each record is processed",
+			Input: Input{
+				Text: `{"user": "alice", "email": "alice@example.com"}
+{"user":"bob","email":"bob@example.com","tags":["a"]}
+
+{"user": "carol"}`,
+			},
+			Expect: Expect{
+				Text: `{"user": "alice", "email": "ENC[alice@example.com]"}
+{"user":"bob","email":"ENC[bob@example.com]","tags":["a"]}
+
+{"user": "carol"}`,
+			},
+		},
+		{
+			Title: "line endings are kept",
+			Input: Input{
+				Text: "{\"email\": \"a\"}\r\n{\"email\": \"b\"}\r\n",
+			},
+			Expect: Expect{
+				Text: "{\"email\": \"ENC[a]\"}\r\n{\"email\": \"ENC[b]\"}\r\n",
+			},
+		},
+		{
+			Title: "invalid record",
+			Input: Input{
+				Text: `{"email": "a"}
+{"email":
+`,
+			},
+			Expect: Expect{
+				Error: "ndjson: line 2: unexpected EOF",
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf := &bytes.Buffer{}
+			err := ndjsonCodec{}.process(strings.NewReader(test.Input.Text), buf, func(acc accessor.Accessor) error {
+				path := mustParsePath(t, "email")
+				v, err := acc.Get(path)
+				if err != nil {
+					return nil
+				}
+				return acc.Set(path, "ENC["+v.Unwrap().(string)+"]")
+			})
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// textSpan is a span of a source.
+type textSpan struct {
+	start, end int
+}
+
+// joinPath joins path into a string used as a key of maps.
+func joinPath(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// textEdit replaces src[start:end] by text.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits returns src with edits applied.
+// it returns false if edits overlap.
+func applyEdits(src []byte, edits []textEdit) ([]byte, bool) {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	buf := &bytes.Buffer{}
+	pos := 0
+	for _, e := range edits {
+		if e.start < pos {
+			return nil, false
+		}
+		buf.Write(src[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.Write(src[pos:])
+	return buf.Bytes(), true
+}
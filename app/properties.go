@@ -0,0 +1,269 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/morikuni/accessor"
+)
+
+// propertiesCodec reads a java properties file.
+// each key is a path of the document, and the file is written back
+// with only changed values rewritten.
+type propertiesCodec struct {
+	src     []byte
+	orig    map[string]interface{}
+	entries map[string]propertiesEntry
+	// sep is the separator of the first key, used for added keys.
+	sep string
+}
+
+// propertiesEntry is the location of the last definition of a key.
+type propertiesEntry struct {
+	// start and end is the span of the value, which may continue over lines.
+	start, end int
+	// lineStart and lineEnd is the span of the logical line including the newline.
+	lineStart, lineEnd int
+}
+
+func (c *propertiesCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	c.src, c.sep = bs, "="
+	c.entries = make(map[string]propertiesEntry)
+	obj := make(map[string]interface{})
+	orig := make(map[string]interface{})
+
+	pos := 0
+	for line := 1; pos < len(bs); line++ {
+		lineStart := pos
+		for pos < len(bs) && (bs[pos] == ' ' || bs[pos] == '\t' || bs[pos] == '\f') {
+			pos++
+		}
+		if pos >= len(bs) || bs[pos] == '\n' || bs[pos] == '\r' || bs[pos] == '#' || bs[pos] == '!' {
+			for pos < len(bs) && bs[pos] != '\n' {
+				pos++
+			}
+			pos++
+			continue
+		}
+
+		// the logical line continues while a line ends with an odd number of backslashes.
+		end := pos
+		for {
+			for end < len(bs) && bs[end] != '\n' && bs[end] != '\r' {
+				end++
+			}
+			n := 0
+			for i := end - 1; i >= pos && bs[i] == '\\'; i-- {
+				n++
+			}
+			if n%2 == 0 || end >= len(bs) {
+				break
+			}
+			if bs[end] == '\r' && end+1 < len(bs) && bs[end+1] == '\n' {
+				end++
+			}
+			end++
+			line++
+		}
+
+		keyStart := pos
+		for pos < end && strings.IndexByte("=: \t\f", bs[pos]) < 0 {
+			if bs[pos] == '\\' {
+				pos++
+			}
+			pos++
+		}
+		keyEnd := pos
+		for pos < end && (bs[pos] == ' ' || bs[pos] == '\t' || bs[pos] == '\f') {
+			pos++
+		}
+		if pos < end && (bs[pos] == '=' || bs[pos] == ':') {
+			pos++
+		}
+		for pos < end && (bs[pos] == ' ' || bs[pos] == '\t' || bs[pos] == '\f') {
+			pos++
+		}
+
+		key, err := unescapeProperties(bs[keyStart:keyEnd])
+		if err != nil {
+			return nil, fmt.Errorf("properties: line %d: %s", line, err)
+		}
+		value, err := unescapeProperties(bs[pos:end])
+		if err != nil {
+			return nil, fmt.Errorf("properties: line %d: %s", line, err)
+		}
+		if len(c.entries) == 0 {
+			c.sep = string(bs[keyEnd:pos])
+		}
+
+		e := propertiesEntry{start: pos, end: end, lineStart: lineStart}
+		pos = end
+		if pos < len(bs) && bs[pos] == '\r' {
+			pos++
+		}
+		if pos < len(bs) && bs[pos] == '\n' {
+			pos++
+		}
+		e.lineEnd = pos
+
+		obj[key], orig[key] = value, value
+		c.entries[key] = e
+	}
+
+	c.orig = orig
+	return accessor.NewAccessor(obj)
+}
+
+func (c *propertiesCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	obj, ok := acc.Unwrap().(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("properties document must be a map")
+	}
+
+	var edits []textEdit
+	for k, e := range c.entries {
+		v, ok := obj[k]
+		if !ok {
+			edits = append(edits, textEdit{e.lineStart, e.lineEnd, ""})
+			continue
+		}
+		s, err := propertiesString(k, v)
+		if err != nil {
+			return err
+		}
+		if s != c.orig[k] {
+			edits = append(edits, textEdit{e.start, e.end, escapeProperties(s, false)})
+		}
+	}
+	bs, _ := applyEdits(c.src, edits)
+
+	var added []string
+	for k := range obj {
+		if _, ok := c.entries[k]; !ok {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	buf := bytes.NewBuffer(bs)
+	for _, k := range added {
+		s, err := propertiesString(k, obj[k])
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "%s%s%s\n", escapeProperties(k, true), c.sep, escapeProperties(s, false))
+	}
+	_, err := output.Write(buf.Bytes())
+	return err
+}
+
+func propertiesString(key string, v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return "", fmt.Errorf("cannot write %q to properties: nested values are not supported", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// unescapeProperties interprets escapes and line continuations.
+func unescapeProperties(bs []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(bs); i++ {
+		c := bs[i]
+		if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(bs) {
+			break
+		}
+		switch c = bs[i]; c {
+		case '\r', '\n':
+			// a line continuation. leading spaces of the next line are ignored.
+			if c == '\r' && i+1 < len(bs) && bs[i+1] == '\n' {
+				i++
+			}
+			for i+1 < len(bs) && (bs[i+1] == ' ' || bs[i+1] == '\t' || bs[i+1] == '\f') {
+				i++
+			}
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(bs) {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			r, err := strconv.ParseUint(string(bs[i+1:i+5]), 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape")
+			}
+			i += 4
+			// surrogate pairs are written as two escapes.
+			if utf16.IsSurrogate(rune(r)) && i+6 < len(bs) && bs[i+1] == '\\' && bs[i+2] == 'u' {
+				if r2, err := strconv.ParseUint(string(bs[i+3:i+7]), 16, 16); err == nil {
+					buf.WriteRune(utf16.DecodeRune(rune(r), rune(r2)))
+					i += 6
+					continue
+				}
+			}
+			buf.WriteRune(rune(r))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), nil
+}
+
+// escapeProperties escapes s as a key or a value.
+// characters other than printable ascii are written as \u escapes.
+func escapeProperties(s string, key bool) string {
+	buf := &bytes.Buffer{}
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			buf.WriteString(`\ `)
+		case strings.ContainsRune("=:#!", r) && (key || i == 0):
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(buf, `\u%04x`, u)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
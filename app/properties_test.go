@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertiesCodec(t *testing.T) {
+	type Input struct {
+		Text   string
+		Values map[string]interface{}
+	}
+	type Expect struct {
+		Values map[string]interface{}
+		Text   string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "parse",
+			Input: Input{
+				Text: `# database
+! legacy comment
+db.user = admin
+db.password:se\=cret
+db\ name  main
+db.url = jdbc:postgresql://host/\
+         main
+greeting = こんにちは
+`,
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"db.user":     "admin",
+					"db.password": "se=cret",
+					"db name":     "main",
+					"db.url":      "jdbc:postgresql://host/main",
+					"greeting":    "こんにちは",
+				},
+				Text: `# database
+! legacy comment
+db.user = admin
+db.password:se\=cret
+db\ name  main
+db.url = jdbc:postgresql://host/\
+         main
+greeting = こんにちは
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `# the password
+db.password = secret
+db.url = jdbc:postgresql://host/\
+         main
+db.user = admin
+`,
+				Values: map[string]interface{}{
+					"db.password": "ENC[xxx]",
+					"db.url":      "ENC[yyy]",
+					"db.host":     "ホスト",
+				},
+			},
+			Expect: Expect{
+				Text: `# the password
+db.password = ENC[xxx]
+db.url = ENC[yyy]
+db.user = admin
+db.host = \u30db\u30b9\u30c8
+`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("properties", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Values != nil {
+				assert.Equal(test.Expect.Values, acc.Unwrap())
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/morikuni/accessor"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrSignatureMissing   = errors.New("signature is missing in the document")
+	ErrSignatureInvalid   = errors.New("signature is invalid. the document may have been tampered with")
+	ErrUntrustedSigner    = errors.New("the document is signed by an untrusted key")
+	ErrTrustedKeysMissing = errors.New("trusted-keys is required to verify the signature")
+)
+
+const (
+	signatureField  = "signature"
+	signingKeyField = "signing_key"
+)
+
+// generateKeyFile writes a new private key to file, or stdout if file is empty.
+// the public key is written to stderr.
+func generateKeyFile(stdout, stderr io.Writer, file string) error {
+	if file == "" {
+		return generateSigningKey(stdout, stderr)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return generateSigningKey(f, stderr)
+}
+
+// generateSigningKey writes a new private key to output, and the public key to info.
+func generateSigningKey(output, info io.Writer) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(output, base64.StdEncoding.EncodeToString(priv)); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(info, "public key: %s\n", base64.StdEncoding.EncodeToString(pub))
+	return err
+}
+
+// readSigningKey reads a base64-encoded ed25519 private key from file.
+func readSigningKey(file string) (ed25519.PrivateKey, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(bs)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid signing key: %s", file)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// readTrustedKeys reads base64-encoded ed25519 public keys from file, one per line.
+// empty lines and lines starting with "#" are ignored.
+func readTrustedKeys(file string) ([]ed25519.PublicKey, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []ed25519.PublicKey
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid trusted key: %q", line)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// addSignature signs the canonicalized document by key,
+// and stores the signature and the public key in the metadata section.
+// the metadata section is signed too, except the signature itself.
+func addSignature(key ed25519.PrivateKey, acc accessor.Accessor) error {
+	md := getMetadata(acc)
+	if md == nil {
+		md = make(map[string]interface{})
+	}
+	delete(md, signatureField)
+	md[signingKeyField] = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	if err := setMetadata(acc, md); err != nil {
+		return err
+	}
+	doc := canonicalizeDocument(acc, signatureField)
+	md[signatureField] = base64.StdEncoding.EncodeToString(ed25519.Sign(key, doc))
+	return setMetadata(acc, md)
+}
+
+// verifySignature checks the signature stored by addSignature is made by one of trustedKeys.
+func verifySignature(trustedKeys []ed25519.PublicKey, acc accessor.Accessor) error {
+	md := getMetadata(acc)
+	sigText, ok1 := md[signatureField].(string)
+	keyText, ok2 := md[signingKeyField].(string)
+	if !ok1 || !ok2 {
+		return ErrSignatureMissing
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigText)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	signer, err := base64.StdEncoding.DecodeString(keyText)
+	if err != nil {
+		return ErrUntrustedSigner
+	}
+
+	var key ed25519.PublicKey
+	for _, k := range trustedKeys {
+		if string(k) == string(signer) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return ErrUntrustedSigner
+	}
+
+	if !ed25519.Verify(key, canonicalizeDocument(acc, signatureField), sig) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestSignature(t *testing.T) {
+	trusted, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, untrustedKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Input struct {
+		Key    ed25519.PrivateKey
+		Tamper func(obj map[string]interface{})
+	}
+	type Expect struct {
+		Err error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "valid",
+			Input: Input{
+				Key:    key,
+				Tamper: func(obj map[string]interface{}) {},
+			},
+			Expect: Expect{
+				Err: nil,
+			},
+		},
+		{
+			Title: "untrusted",
+			Input: Input{
+				Key:    untrustedKey,
+				Tamper: func(obj map[string]interface{}) {},
+			},
+			Expect: Expect{
+				Err: ErrUntrustedSigner,
+			},
+		},
+		{
+			Title: "tampered",
+			Input: Input{
+				Key: key,
+				Tamper: func(obj map[string]interface{}) {
+					obj["password"] = "plaintext"
+				},
+			},
+			Expect: Expect{
+				Err: ErrSignatureInvalid,
+			},
+		},
+		{
+			Title: "metadata tampered",
+			Input: Input{
+				Key: key,
+				Tamper: func(obj map[string]interface{}) {
+					obj[MetadataKey].(map[string]interface{})["pattern"] = "^$"
+				},
+			},
+			Expect: Expect{
+				Err: ErrSignatureInvalid,
+			},
+		},
+		{
+			Title: "signature deleted",
+			Input: Input{
+				Key: key,
+				Tamper: func(obj map[string]interface{}) {
+					delete(obj, MetadataKey)
+				},
+			},
+			Expect: Expect{
+				Err: ErrSignatureMissing,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, err := accessor.NewAccessor(map[string]interface{}{
+				"password": "encrypted",
+				"age":      float64(18),
+			})
+			assert.Nil(err)
+			assert.Nil(addSignature(test.Input.Key, acc))
+
+			test.Input.Tamper(acc.Unwrap().(map[string]interface{}))
+
+			assert.Equal(test.Expect.Err, verifySignature([]ed25519.PublicKey{trusted}, acc))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/morikuni/gipher"
+)
+
+// isStreamFormat reports whether format treats input as opaque bytes processed by processStream.
+// "raw" is only another name of "binary", for files such as keystores that are not thought of as binary data.
+func isStreamFormat(format string) bool {
+	return format == "binary" || format == "raw"
+}
+
+// processStream encrypts/decrypts input as a binary stream without loading it into memory.
+// when encrypting with armor, output is base64 text enclosed by BEGIN/END lines.
+// armored input is detected automatically when decrypting.
+// when decrypting, output may receive data of a broken stream before the error is detected.
+func processStream(command string, cryptor gipher.Cryptor, input io.Reader, output io.Writer, armor bool) error {
+	switch command {
+	case "encrypt":
+		if armor {
+			aw, err := gipher.NewArmorWriter(output)
+			if err != nil {
+				return err
+			}
+			if err := encryptStream(cryptor, input, aw); err != nil {
+				return err
+			}
+			return aw.Close()
+		}
+		return encryptStream(cryptor, input, output)
+	case "decrypt":
+		br := bufio.NewReader(input)
+		input = br
+		if head, _ := br.Peek(64); gipher.IsArmored(head) {
+			ar, err := gipher.NewArmorReader(br)
+			if err != nil {
+				return err
+			}
+			input = ar
+		}
+		r, err := gipher.NewDecryptReader(input, cryptor)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(output, r)
+		return err
+	default:
+		return fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+func encryptStream(cryptor gipher.Cryptor, input io.Reader, output io.Writer) error {
+	w, err := gipher.NewEncryptWriter(output, cryptor)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, input); err != nil {
+		return err
+	}
+	return w.Close()
+}
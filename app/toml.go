@@ -0,0 +1,598 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/morikuni/accessor"
+)
+
+// tomlCodec keeps the source of the document and the location of its values,
+// so that comments, table order and inline tables are reproduced
+// and only changed values are rewritten on encoding.
+// encoding fails with errTOMLNotPatchable if changes cannot be written in place,
+// rather than encoding the whole document again and losing its layout.
+type tomlCodec struct {
+	src    []byte
+	orig   interface{}
+	layout *tomlLayout
+}
+
+func (c *tomlCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	var obj, orig interface{}
+	if _, err = toml.Decode(string(bs), &obj); err != nil {
+		return nil, err
+	}
+	// the accessor modifies obj, so the original values are decoded separately.
+	if _, err = toml.Decode(string(bs), &orig); err != nil {
+		return nil, err
+	}
+	layout, err := scanTOML(bs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", errTOMLNotPatchable, err)
+	}
+	c.src, c.orig, c.layout = bs, orig, layout
+	return accessor.NewAccessor(obj)
+}
+
+func (c *tomlCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	bs, err := c.layout.patch(c.src, c.orig, acc.Unwrap())
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(bs)
+	return err
+}
+
+var errTOMLNotPatchable = errors.New("toml document cannot be rewritten without losing its layout")
+
+// tomlLayout is the location of values in the source.
+type tomlLayout struct {
+	// values maps paths of scalar values to their spans.
+	values map[string]textSpan
+	// topLevel maps top-level keys to spans of lines and tables defining them.
+	topLevel map[string][]textSpan
+	// firstTable is the start of the first table header, or the end of the source.
+	firstTable int
+}
+
+// patch returns src updated from orig to value.
+func (l *tomlLayout) patch(src []byte, orig, value interface{}) ([]byte, error) {
+	var edits []textEdit
+	var appended []string
+	err := l.diff(src, nil, orig, value, &edits, &appended)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, ok := applyEdits(src, edits)
+	if !ok {
+		return nil, errTOMLNotPatchable
+	}
+	buf := bytes.NewBuffer(bs)
+
+	for _, text := range appended {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(text)
+	}
+	return buf.Bytes(), nil
+}
+
+func (l *tomlLayout) diff(src []byte, path []string, orig, value interface{}, edits *[]textEdit, appended *[]string) error {
+	if om, ok := orig.(map[string]interface{}); ok {
+		vm, ok := value.(map[string]interface{})
+		if !ok {
+			return errTOMLNotPatchable
+		}
+		for k, ov := range om {
+			vv, ok := vm[k]
+			if !ok {
+				if len(path) > 0 || len(l.topLevel[k]) == 0 {
+					return errTOMLNotPatchable
+				}
+				for _, span := range l.topLevel[k] {
+					start := span.start
+					// blank lines before a table removed at the end are removed too,
+					// so that a table appended by patch is removed cleanly.
+					for span.end == len(src) && start >= 2 && src[start-1] == '\n' && src[start-2] == '\n' {
+						start--
+					}
+					*edits = append(*edits, textEdit{start, span.end, ""})
+				}
+				continue
+			}
+			if err := l.diff(src, append(path[:len(path):len(path)], k), ov, vv, edits, appended); err != nil {
+				return err
+			}
+		}
+		var added []string
+		for k := range vm {
+			if _, ok := om[k]; !ok {
+				added = append(added, k)
+			}
+		}
+		if len(added) > 0 && len(path) > 0 {
+			return errTOMLNotPatchable
+		}
+		sort.Strings(added)
+		for _, k := range added {
+			if _, ok := vm[k].(map[string]interface{}); ok {
+				buf := &bytes.Buffer{}
+				if err := toml.NewEncoder(buf).Encode(map[string]interface{}{k: vm[k]}); err != nil {
+					return err
+				}
+				*appended = append(*appended, buf.String())
+				continue
+			}
+			text, err := formatTOMLValue(vm[k], "")
+			if err != nil {
+				return err
+			}
+			*edits = append(*edits, textEdit{l.firstTable, l.firstTable, formatTOMLKey(k) + " = " + text + "\n"})
+		}
+		return nil
+	}
+
+	if olds, ok := tomlSlice(orig); ok {
+		news, ok := tomlSlice(value)
+		if !ok || len(olds) != len(news) {
+			return errTOMLNotPatchable
+		}
+		for i := range olds {
+			if err := l.diff(src, append(path[:len(path):len(path)], strconv.Itoa(i)), olds[i], news[i], edits, appended); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(orig, value) {
+		return nil
+	}
+	span, ok := l.values[joinPath(path)]
+	if !ok {
+		return errTOMLNotPatchable
+	}
+	text, err := formatTOMLValue(value, string(src[span.start:span.end]))
+	if err != nil {
+		return err
+	}
+	*edits = append(*edits, textEdit{span.start, span.end, text})
+	return nil
+}
+
+func tomlSlice(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	s := make([]interface{}, rv.Len())
+	for i := range s {
+		s[i] = rv.Index(i).Interface()
+	}
+	return s, true
+}
+
+// formatTOMLValue formats a scalar value.
+// the literal style of old is kept for strings if possible.
+func formatTOMLValue(v interface{}, old string) (string, error) {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(old, "'") && !strings.HasPrefix(old, "'''") &&
+			!strings.ContainsAny(v, "'\n\r") && strings.IndexFunc(v, unicode.IsControl) < 0 {
+			return "'" + v + "'", nil
+		}
+		return quoteTOMLString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", nil
+		case math.IsInf(v, 1):
+			return "inf", nil
+		case math.IsInf(v, -1):
+			return "-inf", nil
+		}
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		return "", errTOMLNotPatchable
+	}
+}
+
+func quoteTOMLString(s string) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteString(`"`)
+	return buf.String()
+}
+
+func formatTOMLKey(k string) string {
+	bare := k != ""
+	for _, r := range k {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			bare = false
+		}
+	}
+	if bare {
+		return k
+	}
+	return quoteTOMLString(k)
+}
+
+// scanTOML locates values of a toml document.
+// src must be valid toml, checked by the decoder beforehand.
+func scanTOML(src []byte) (*tomlLayout, error) {
+	s := &tomlScanner{
+		src: src,
+		layout: &tomlLayout{
+			values:     make(map[string]textSpan),
+			topLevel:   make(map[string][]textSpan),
+			firstTable: -1,
+		},
+		arrayIndex: make(map[string]int),
+	}
+	if err := s.document(); err != nil {
+		return nil, err
+	}
+	if s.layout.firstTable < 0 {
+		s.layout.firstTable = len(src)
+	}
+	return s.layout, nil
+}
+
+type tomlScanner struct {
+	src    []byte
+	pos    int
+	layout *tomlLayout
+	// arrayIndex is the index of the last element of each array of tables.
+	arrayIndex map[string]int
+}
+
+func (s *tomlScanner) errorf() error {
+	return fmt.Errorf("unexpected toml at offset %d", s.pos)
+}
+
+func (s *tomlScanner) peek(prefix string) bool {
+	return bytes.HasPrefix(s.src[s.pos:], []byte(prefix))
+}
+
+// skipSpace skips spaces, and also newlines and comments if multiline.
+func (s *tomlScanner) skipSpace(multiline bool) {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == ' ' || c == '\t':
+			s.pos++
+		case multiline && (c == '\n' || c == '\r'):
+			s.pos++
+		case multiline && c == '#':
+			s.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine moves to the start of the next line.
+func (s *tomlScanner) skipLine() {
+	for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+		s.pos++
+	}
+	if s.pos < len(s.src) {
+		s.pos++
+	}
+}
+
+func (s *tomlScanner) lineStart(pos int) int {
+	for pos > 0 && s.src[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+func (s *tomlScanner) document() error {
+	var table []string
+	// section is the span of the current table, which is closed by the next table.
+	var section *textSpan
+	var sectionKey string
+	closeSection := func(end int) {
+		if section != nil {
+			section.end = end
+			s.layout.topLevel[sectionKey] = append(s.layout.topLevel[sectionKey], *section)
+			section = nil
+		}
+	}
+
+	for {
+		s.skipSpace(true)
+		if s.pos >= len(s.src) {
+			closeSection(len(s.src))
+			return nil
+		}
+
+		if s.src[s.pos] == '[' {
+			start := s.lineStart(s.pos)
+			closeSection(start)
+			if s.layout.firstTable < 0 {
+				s.layout.firstTable = start
+			}
+			array := s.peek("[[")
+			if array {
+				s.pos += 2
+			} else {
+				s.pos++
+			}
+			s.skipSpace(false)
+			keys, err := s.key()
+			if err != nil {
+				return err
+			}
+			table = s.resolveTable(keys, array)
+			if array {
+				s.pos++
+			}
+			s.pos++
+			s.skipLine()
+			section, sectionKey = &textSpan{start: start}, keys[0]
+			continue
+		}
+
+		start := s.lineStart(s.pos)
+		keys, err := s.key()
+		if err != nil {
+			return err
+		}
+		if s.pos >= len(s.src) || s.src[s.pos] != '=' {
+			return s.errorf()
+		}
+		s.pos++
+		s.skipSpace(false)
+		if err := s.value(append(table[:len(table):len(table)], keys...)); err != nil {
+			return err
+		}
+		s.skipLine()
+		if table == nil {
+			s.layout.topLevel[keys[0]] = append(s.layout.topLevel[keys[0]], textSpan{start, s.pos})
+		}
+	}
+}
+
+// resolveTable returns the path of a table header,
+// inserting indexes of arrays of tables.
+func (s *tomlScanner) resolveTable(keys []string, array bool) []string {
+	var path []string
+	for i, k := range keys {
+		path = append(path, k)
+		pk := joinPath(path)
+		if i == len(keys)-1 && array {
+			if n, ok := s.arrayIndex[pk]; ok {
+				s.arrayIndex[pk] = n + 1
+			} else {
+				s.arrayIndex[pk] = 0
+			}
+		}
+		if n, ok := s.arrayIndex[pk]; ok {
+			path = append(path, strconv.Itoa(n))
+		}
+	}
+	return path
+}
+
+// key scans a dotted key and the following spaces.
+func (s *tomlScanner) key() ([]string, error) {
+	var keys []string
+	for {
+		if s.pos >= len(s.src) {
+			return nil, s.errorf()
+		}
+		switch s.src[s.pos] {
+		case '"', '\'':
+			start := s.pos
+			if err := s.str(); err != nil {
+				return nil, err
+			}
+			k, err := unquoteTOMLString(string(s.src[start:s.pos]))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		default:
+			start := s.pos
+			for s.pos < len(s.src) && strings.IndexByte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-", s.src[s.pos]) >= 0 {
+				s.pos++
+			}
+			if start == s.pos {
+				return nil, s.errorf()
+			}
+			keys = append(keys, string(s.src[start:s.pos]))
+		}
+		s.skipSpace(false)
+		if s.pos < len(s.src) && s.src[s.pos] == '.' {
+			s.pos++
+			s.skipSpace(false)
+			continue
+		}
+		return keys, nil
+	}
+}
+
+// str scans a string of any kind.
+func (s *tomlScanner) str() error {
+	for _, q := range []string{`"""`, `'''`} {
+		if !s.peek(q) {
+			continue
+		}
+		s.pos += 3
+		for s.pos < len(s.src) {
+			if q[0] == '"' && s.src[s.pos] == '\\' {
+				s.pos += 2
+				continue
+			}
+			if s.peek(q) {
+				s.pos += 3
+				// up to two quotes are allowed just before the delimiter.
+				for i := 0; i < 2 && s.pos < len(s.src) && s.src[s.pos] == q[0]; i++ {
+					s.pos++
+				}
+				return nil
+			}
+			s.pos++
+		}
+		return s.errorf()
+	}
+
+	q := s.src[s.pos]
+	s.pos++
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '\\':
+			if q == '"' {
+				s.pos++
+			}
+		case q:
+			s.pos++
+			return nil
+		case '\n':
+			return s.errorf()
+		}
+		s.pos++
+	}
+	return s.errorf()
+}
+
+func unquoteTOMLString(s string) (string, error) {
+	var m map[string]string
+	if _, err := toml.Decode("k = "+s, &m); err != nil {
+		return "", err
+	}
+	return m["k"], nil
+}
+
+func (s *tomlScanner) value(path []string) error {
+	if s.pos >= len(s.src) {
+		return s.errorf()
+	}
+	start := s.pos
+	switch s.src[s.pos] {
+	case '"', '\'':
+		if err := s.str(); err != nil {
+			return err
+		}
+	case '[':
+		s.pos++
+		for i := 0; ; i++ {
+			s.skipSpace(true)
+			if s.pos >= len(s.src) {
+				return s.errorf()
+			}
+			if s.src[s.pos] == ']' {
+				s.pos++
+				return nil
+			}
+			if err := s.value(append(path[:len(path):len(path)], strconv.Itoa(i))); err != nil {
+				return err
+			}
+			s.skipSpace(true)
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			}
+		}
+	case '{':
+		s.pos++
+		for {
+			s.skipSpace(false)
+			if s.pos >= len(s.src) {
+				return s.errorf()
+			}
+			if s.src[s.pos] == '}' {
+				s.pos++
+				return nil
+			}
+			keys, err := s.key()
+			if err != nil {
+				return err
+			}
+			if s.pos >= len(s.src) || s.src[s.pos] != '=' {
+				return s.errorf()
+			}
+			s.pos++
+			s.skipSpace(false)
+			if err := s.value(append(path[:len(path):len(path)], keys...)); err != nil {
+				return err
+			}
+			s.skipSpace(false)
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			}
+		}
+	default:
+		for s.pos < len(s.src) && strings.IndexByte(" \t\r\n,]}#", s.src[s.pos]) < 0 {
+			s.pos++
+		}
+		// a date and a time may be separated by a space.
+		if s.pos-start == 10 && s.peek(" ") && s.pos+1 < len(s.src) && s.src[s.pos+1] >= '0' && s.src[s.pos+1] <= '9' {
+			s.pos++
+			for s.pos < len(s.src) && strings.IndexByte(" \t\r\n,]}#", s.src[s.pos]) < 0 {
+				s.pos++
+			}
+		}
+	}
+	if start == s.pos {
+		return s.errorf()
+	}
+	s.layout.values[joinPath(path)] = textSpan{start, s.pos}
+	return nil
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOMLCodec(t *testing.T) {
+	type Input struct {
+		Text     string
+		Values   map[string]interface{}
+		Metadata map[string]interface{}
+		Strip    bool
+	}
+	type Expect struct {
+		Text string
+		Err  error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "nothing changed",
+			Input: Input{
+				Text: `# service config
+title = "api" # the name
+
+[database]
+user = 'admin'
+password = "secret"
+ports = [ 8000,
+  8001 ]
+created = 1979-05-27 07:32:00Z
+
+[[users]]
+name = "alice"
+`,
+			},
+			Expect: Expect{
+				Text: `# service config
+title = "api" # the name
+
+[database]
+user = 'admin'
+password = "secret"
+ports = [ 8000,
+  8001 ]
+created = 1979-05-27 07:32:00Z
+
+[[users]]
+name = "alice"
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `zebra = 1
+[database]
+# the password
+password = 'secret' # keep me
+options = { user = "admin", "pass word" = "x" }
+
+[[users]]
+name = "alice"
+
+[[users]]
+name = "bob"
+`,
+				Values: map[string]interface{}{
+					"database/password":          "ENC[xxx]",
+					"database/options/pass word": "ENC[yyy]",
+					"users/1/name":               "ENC[zzz]",
+				},
+			},
+			Expect: Expect{
+				Text: `zebra = 1
+[database]
+# the password
+password = 'ENC[xxx]' # keep me
+options = { user = "admin", "pass word" = "ENC[yyy]" }
+
+[[users]]
+name = "alice"
+
+[[users]]
+name = "ENC[zzz]"
+`,
+			},
+		},
+		{
+			Title: "type is changed",
+			Input: Input{
+				Text: `age = "aW50OjE4"
+ratio = 'x'
+`,
+				Values: map[string]interface{}{
+					"age":   int64(18),
+					"ratio": float64(2),
+				},
+			},
+			Expect: Expect{
+				Text: `age = 18
+ratio = 2.0
+`,
+			},
+		},
+		{
+			Title: "metadata is appended",
+			Input: Input{
+				Text: `name = "Alice"
+
+[database]
+password = "secret"
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `name = "Alice"
+
+[database]
+password = "secret"
+
+[gipher]
+  version = "1.0"
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `name = "Alice"
+
+[database]
+password = "secret"
+
+[gipher]
+version = "1.0"
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `name = "Alice"
+
+[database]
+password = "secret"
+`,
+			},
+		},
+		{
+			Title: "key added to a table",
+			Input: Input{
+				Text: `[database]
+user = "admin"
+`,
+				Values: map[string]interface{}{
+					"database/password": "secret",
+				},
+			},
+			Expect: Expect{
+				Err: errTOMLNotPatchable,
+			},
+		},
+		{
+			Title: "table replaced by a value",
+			Input: Input{
+				Text: `[database]
+user = "admin"
+`,
+				Values: map[string]interface{}{
+					"database": "ENC[...]",
+				},
+			},
+			Expect: Expect{
+				Err: errTOMLNotPatchable,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("toml", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			err = c.encode(buf, acc)
+			assert.Equal(test.Expect.Err, err)
+			if err == nil {
+				assert.Equal(test.Expect.Text, buf.String())
+			}
+		})
+	}
+}
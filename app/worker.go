@@ -0,0 +1,80 @@
+package app
+
+import (
+	"sync"
+
+	"github.com/morikuni/accessor"
+)
+
+type field struct {
+	path  accessor.Path
+	value interface{}
+}
+
+type result struct {
+	value     interface{}
+	shouldSet bool
+}
+
+// processFields applies fn to each field using at most concurrency workers.
+// results are returned in the same order as fields.
+// when fn fails, the error of the first failed field in order is returned,
+// as if the fields were processed sequentially.
+func processFields(fields []field, concurrency int, fn func(value interface{}) (interface{}, bool, error)) ([]result, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]result, len(fields))
+	errs := make([]error, len(fields))
+
+	var (
+		mu       sync.Mutex
+		failedAt = len(fields)
+	)
+	shouldSkip := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i > failedAt
+	}
+	fail := func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i < failedAt {
+			failedAt = i
+		}
+	}
+
+	indices := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if shouldSkip(i) {
+					continue
+				}
+				value, shouldSet, err := fn(fields[i].value)
+				if err != nil {
+					errs[i] = err
+					fail(i)
+					continue
+				}
+				results[i] = result{value, shouldSet}
+			}
+		}()
+	}
+	for i := range fields {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
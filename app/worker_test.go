@@ -0,0 +1,106 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFields(t *testing.T) {
+	type Input struct {
+		Values      []interface{}
+		Concurrency int
+	}
+	type Expect struct {
+		Values []interface{}
+		Err    error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	fn := func(value interface{}) (interface{}, bool, error) {
+		switch v := value.(type) {
+		case int:
+			return v * 2, true, nil
+		case string:
+			return nil, false, errors.New(v)
+		default:
+			return nil, false, nil
+		}
+	}
+
+	table := []Test{
+		{
+			Title: "sequential",
+			Input: Input{
+				Values:      []interface{}{1, 2, 3},
+				Concurrency: 1,
+			},
+			Expect: Expect{
+				Values: []interface{}{2, 4, 6},
+				Err:    nil,
+			},
+		},
+		{
+			Title: "parallel keeps order",
+			Input: Input{
+				Values:      []interface{}{1, 2, 3, 4, 5, 6, 7, 8},
+				Concurrency: 3,
+			},
+			Expect: Expect{
+				Values: []interface{}{2, 4, 6, 8, 10, 12, 14, 16},
+				Err:    nil,
+			},
+		},
+		{
+			Title: "not set",
+			Input: Input{
+				Values:      []interface{}{1, true, 3},
+				Concurrency: 2,
+			},
+			Expect: Expect{
+				Values: []interface{}{2, nil, 6},
+				Err:    nil,
+			},
+		},
+		{
+			Title: "first error",
+			Input: Input{
+				Values:      []interface{}{1, "first", 3, "second", "third"},
+				Concurrency: 4,
+			},
+			Expect: Expect{
+				Values: nil,
+				Err:    errors.New("first"),
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			fields := make([]field, len(test.Input.Values))
+			for i, v := range test.Input.Values {
+				fields[i] = field{nil, v}
+			}
+
+			results, err := processFields(fields, test.Input.Concurrency, fn)
+
+			assert.Equal(test.Expect.Err, err)
+			if test.Expect.Values == nil {
+				assert.Nil(results)
+				return
+			}
+			values := make([]interface{}, len(results))
+			for i, r := range results {
+				values[i] = r.value
+			}
+			assert.Equal(test.Expect.Values, values)
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/morikuni/accessor"
+)
+
+// xmlCodec reads an xml document.
+// the root element is the first part of paths, elements with the same name are lists,
+// and attributes are keys prefixed by "@" (e.g. "settings/servers/server/0/@id").
+// text of elements having attributes or children is "#text", which exists only if they have a text.
+// namespace declarations (xmlns and xmlns:*) are not values.
+// the metadata section is the last child of the root element.
+// the document is written back with only changed texts and attributes rewritten.
+type xmlCodec struct {
+	src  []byte
+	root *xmlElement
+	orig interface{}
+	// values maps paths of texts and attributes to their locations.
+	values map[string]xmlValue
+}
+
+type xmlElement struct {
+	name     string
+	attrs    []xmlAttr
+	children []*xmlElement
+	texts    []xmlText
+	// start and end is the span of the element including tags.
+	start, end int
+	// contentStart and contentEnd is the span between the tags.
+	contentStart, contentEnd int
+	selfClosing              bool
+}
+
+type xmlAttr struct {
+	name, value string
+	// start and end is the span of the value excluding quotes.
+	start, end int
+	quote      byte
+}
+
+type xmlText struct {
+	text       string
+	start, end int
+	cdata      bool
+}
+
+type xmlValue struct {
+	textSpan
+	attr  byte // the quote of an attribute, or 0 for a text.
+	cdata bool
+}
+
+const xmlTextKey = "#text"
+
+func (c *xmlCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXML(bs)
+	if err != nil {
+		return nil, err
+	}
+	c.src, c.root = bs, root
+
+	c.values = make(map[string]xmlValue)
+	obj := c.document()
+	c.orig = c.document()
+	return accessor.NewAccessor(obj)
+}
+
+// document returns the value of the document.
+func (c *xmlCodec) document() map[string]interface{} {
+	obj := map[string]interface{}{}
+	root := c.root
+	if md := c.metadataElement(); md != nil {
+		obj[MetadataKey] = c.value(md, []string{MetadataKey})
+		// the metadata element is hidden from the root element.
+		r := *root
+		r.children = root.children[:len(root.children)-1]
+		root = &r
+	}
+	obj[root.name] = c.value(root, []string{root.name})
+	return obj
+}
+
+func (c *xmlCodec) metadataElement() *xmlElement {
+	if n := len(c.root.children); n > 0 && c.root.children[n-1].name == MetadataKey {
+		return c.root.children[n-1]
+	}
+	return nil
+}
+
+func (c *xmlCodec) value(e *xmlElement, path []string) interface{} {
+	sub := func(k string) []string {
+		return append(path[:len(path):len(path)], k)
+	}
+
+	var text []xmlText
+	for _, t := range e.texts {
+		if strings.TrimSpace(t.text) != "" || t.cdata {
+			text = append(text, t)
+		}
+	}
+	textValue := func(p []string) string {
+		s := ""
+		for _, t := range text {
+			s += t.text
+		}
+		switch {
+		case len(text) == 1:
+			c.values[joinPath(p)] = xmlValue{textSpan: textSpan{text[0].start, text[0].end}, cdata: text[0].cdata}
+		case len(text) == 0 && !e.selfClosing && len(e.children) == 0:
+			c.values[joinPath(p)] = xmlValue{textSpan: textSpan{e.contentStart, e.contentEnd}}
+		}
+		return s
+	}
+
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		return textValue(path)
+	}
+
+	m := make(map[string]interface{})
+	for _, a := range e.attrs {
+		k := "@" + a.name
+		m[k] = a.value
+		c.values[joinPath(sub(k))] = xmlValue{textSpan: textSpan{a.start, a.end}, attr: a.quote}
+	}
+	count := make(map[string]int)
+	for _, child := range e.children {
+		count[child.name]++
+	}
+	for _, child := range e.children {
+		if count[child.name] == 1 {
+			m[child.name] = c.value(child, sub(child.name))
+			continue
+		}
+		list, _ := m[child.name].([]interface{})
+		m[child.name] = append(list, c.value(child, append(sub(child.name), strconv.Itoa(len(list)))))
+	}
+	if len(text) > 0 {
+		m[xmlTextKey] = textValue(sub(xmlTextKey))
+	}
+	return m
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// parseXML returns the root element with the location of its contents.
+func parseXML(src []byte) (*xmlElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(src))
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		start := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end := int(d.InputOffset())
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &xmlElement{
+				name:         xmlName(t.Name),
+				start:        start,
+				contentStart: end,
+				selfClosing:  bytes.HasSuffix(src[start:end], []byte("/>")),
+			}
+			e.attrs, err = scanXMLAttrs(src[start:end], start, t.Attr)
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, fmt.Errorf("xml: multiple root elements")
+			} else {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("xml: unexpected end element </%s>", xmlName(t.Name))
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if e.name != xmlName(t.Name) {
+				return nil, fmt.Errorf("xml: element <%s> closed by </%s>", e.name, xmlName(t.Name))
+			}
+			e.contentEnd, e.end = start, end
+			if e.selfClosing {
+				e.contentEnd, e.end = e.contentStart, e.contentStart
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				e := stack[len(stack)-1]
+				e.texts = append(e.texts, xmlText{
+					text:  string(t),
+					start: start,
+					end:   end,
+					cdata: bytes.HasPrefix(src[start:end], []byte("<![CDATA[")),
+				})
+			}
+		}
+	}
+	if root == nil {
+		return nil, ErrEmptyInput
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("xml: element <%s> is not closed", stack[len(stack)-1].name)
+	}
+	return root, nil
+}
+
+// scanXMLAttrs locates values of attrs in the start tag.
+// namespace declarations are skipped.
+func scanXMLAttrs(tag []byte, offset int, attrs []xml.Attr) ([]xmlAttr, error) {
+	var result []xmlAttr
+	pos := 1
+	for pos < len(tag) && !isXMLSpace(tag[pos]) && tag[pos] != '>' && tag[pos] != '/' {
+		pos++
+	}
+	for _, a := range attrs {
+		q := -1
+		for pos < len(tag) {
+			if tag[pos] == '"' || tag[pos] == '\'' {
+				q = pos
+				break
+			}
+			pos++
+		}
+		if q < 0 {
+			return nil, fmt.Errorf("xml: attribute %q is not quoted", xmlName(a.Name))
+		}
+		end := bytes.IndexByte(tag[q+1:], tag[q])
+		if end < 0 {
+			return nil, fmt.Errorf("xml: attribute %q is not closed", xmlName(a.Name))
+		}
+		pos = q + 1 + end + 1
+		if isXMLNamespace(a.Name) {
+			continue
+		}
+		result = append(result, xmlAttr{
+			name:  xmlName(a.Name),
+			value: a.Value,
+			start: offset + q + 1,
+			end:   offset + q + 1 + end,
+			quote: tag[q],
+		})
+	}
+	return result, nil
+}
+
+func isXMLNamespace(n xml.Name) bool {
+	return n.Space == "xmlns" || n.Space == "" && n.Local == "xmlns"
+}
+
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func (c *xmlCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	obj, ok := acc.Unwrap().(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("xml document must be a map")
+	}
+	orig := c.orig.(map[string]interface{})
+
+	var edits []textEdit
+	for k, v := range obj {
+		if k == c.root.name {
+			continue
+		}
+		if k != MetadataKey {
+			return fmt.Errorf("cannot add %q to xml: a document has only one root element", k)
+		}
+		if _, ok := orig[MetadataKey]; ok {
+			continue
+		}
+		edit, err := c.metadataEdit(v)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, edit)
+	}
+	if _, ok := orig[MetadataKey]; ok {
+		md := c.metadataElement()
+		if v, ok := obj[MetadataKey]; ok {
+			if err := c.diff([]string{MetadataKey}, orig[MetadataKey], v, &edits); err != nil {
+				return err
+			}
+		} else {
+			start := md.start
+			for start > c.root.contentStart && isXMLSpace(c.src[start-1]) {
+				start--
+			}
+			edits = append(edits, textEdit{start, md.end, ""})
+		}
+	}
+
+	v, ok := obj[c.root.name]
+	if !ok {
+		return fmt.Errorf("cannot remove the root element of xml")
+	}
+	if err := c.diff([]string{c.root.name}, orig[c.root.name], v, &edits); err != nil {
+		return err
+	}
+
+	bs, ok := applyEdits(c.src, edits)
+	if !ok {
+		return fmt.Errorf("cannot write changes to xml")
+	}
+	_, err := output.Write(bs)
+	return err
+}
+
+// metadataEdit returns an edit adding the metadata element as the last child of the root element.
+func (c *xmlCodec) metadataEdit(v interface{}) (textEdit, error) {
+	buf := &bytes.Buffer{}
+	if err := writeXMLElement(buf, MetadataKey, v); err != nil {
+		return textEdit{}, err
+	}
+
+	if c.root.selfClosing {
+		// "/>" of the root element is replaced by ">" and the closing tag.
+		pos := c.root.contentStart - len("/>")
+		return textEdit{pos, c.root.contentStart, ">" + buf.String() + "</" + c.root.name + ">"}, nil
+	}
+
+	// the element is written on its own line, indented like the first child,
+	// if the closing tag of the root element is on its own line, and just before the tag otherwise.
+	content := c.src[c.root.contentStart:c.root.contentEnd]
+	nl := bytes.LastIndexByte(content, '\n')
+	if nl < 0 || len(bytes.TrimSpace(content[nl:])) > 0 {
+		return textEdit{c.root.contentEnd, c.root.contentEnd, buf.String()}, nil
+	}
+	indent := "  "
+	if len(c.root.children) > 0 {
+		before := c.src[c.root.contentStart:c.root.children[0].start]
+		if i := bytes.LastIndexByte(before, '\n'); i >= 0 && len(bytes.TrimSpace(before[i:])) == 0 {
+			indent = string(before[i+1:])
+		}
+	}
+	pos := c.root.contentStart + nl + 1
+	return textEdit{pos, pos, indent + buf.String() + "\n"}, nil
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, v interface{}) error {
+	fmt.Fprintf(buf, "<%s>", name)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := writeXMLElement(buf, k, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}, map[interface{}]interface{}:
+		return fmt.Errorf("cannot write %T to xml", v)
+	default:
+		buf.WriteString(escapeXML(xmlString(v), 0))
+	}
+	fmt.Fprintf(buf, "</%s>", name)
+	return nil
+}
+
+func (c *xmlCodec) diff(path []string, orig, value interface{}, edits *[]textEdit) error {
+	p := strings.Join(path, "/")
+	switch o := orig.(type) {
+	case map[string]interface{}:
+		vm, ok := value.(map[string]interface{})
+		if !ok || len(vm) != len(o) {
+			return fmt.Errorf("cannot write %q to xml: only texts and attributes can be changed", p)
+		}
+		for k, ov := range o {
+			vv, ok := vm[k]
+			if !ok {
+				return fmt.Errorf("cannot write %q to xml: only texts and attributes can be changed", p)
+			}
+			if err := c.diff(append(path[:len(path):len(path)], k), ov, vv, edits); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		vs, ok := value.([]interface{})
+		if !ok || len(o) != len(vs) {
+			return fmt.Errorf("cannot write %q to xml: only texts and attributes can be changed", p)
+		}
+		for i := range o {
+			if err := c.diff(append(path[:len(path):len(path)], strconv.Itoa(i)), o[i], vs[i], edits); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(orig, value) {
+		return nil
+	}
+	if isMap(value) {
+		return fmt.Errorf("cannot write %q to xml: only texts and attributes can be changed", p)
+	}
+	v, ok := c.values[joinPath(path)]
+	if !ok {
+		return fmt.Errorf("cannot write %q to xml: the element has no single text node", p)
+	}
+	s := xmlString(value)
+	var text string
+	switch {
+	case v.cdata && !strings.Contains(s, "]]>"):
+		text = "<![CDATA[" + s + "]]>"
+	default:
+		text = escapeXML(s, v.attr)
+	}
+	*edits = append(*edits, textEdit{v.start, v.end, text})
+	return nil
+}
+
+func xmlString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeXML escapes s as a text, or as an attribute quoted by quote.
+func escapeXML(s string, quote byte) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	switch quote {
+	case '"':
+		r = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+	case '\'':
+		r = strings.NewReplacer("&", "&amp;", "<", "&lt;", "'", "&apos;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+	}
+	return r.Replace(s)
+}
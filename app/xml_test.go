@@ -0,0 +1,254 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMLCodec(t *testing.T) {
+	type Input struct {
+		Text     string
+		Values   map[string]interface{}
+		Metadata map[string]interface{}
+		Strip    bool
+	}
+	type Expect struct {
+		Values map[string]interface{}
+		Text   string
+		Error  string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "parse",
+			Input: Input{
+				Text: `<?xml version="1.0" encoding="UTF-8"?>
+<settings xmlns="http://maven.apache.org/SETTINGS/1.0.0">
+  <!-- servers -->
+  <servers>
+    <server id="a">
+      <username>admin</username>
+      <password>s&amp;cret</password>
+    </server>
+    <server id='b'>
+      <password><![CDATA[<secret>]]></password>
+    </server>
+  </servers>
+  <empty></empty>
+</settings>
+`,
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"settings": map[string]interface{}{
+						"servers": map[string]interface{}{
+							"server": []interface{}{
+								map[string]interface{}{
+									"@id":      "a",
+									"username": "admin",
+									"password": "s&cret",
+								},
+								map[string]interface{}{
+									"@id":      "b",
+									"password": "<secret>",
+								},
+							},
+						},
+						"empty": "",
+					},
+				},
+				Text: `<?xml version="1.0" encoding="UTF-8"?>
+<settings xmlns="http://maven.apache.org/SETTINGS/1.0.0">
+  <!-- servers -->
+  <servers>
+    <server id="a">
+      <username>admin</username>
+      <password>s&amp;cret</password>
+    </server>
+    <server id='b'>
+      <password><![CDATA[<secret>]]></password>
+    </server>
+  </servers>
+  <empty></empty>
+</settings>
+`,
+			},
+		},
+		{
+			Title: "only changed texts and attributes are rewritten",
+			Input: Input{
+				Text: `<Context xmlns:x="urn:x">
+  <Resource name="jdbc/db" password='secret' x:token="t"/>
+  <x:key>old</x:key>
+  <cdata><![CDATA[old]]></cdata>
+  <empty></empty>
+</Context>
+`,
+				Values: map[string]interface{}{
+					"Context/Resource/@password": "ENC['xxx']",
+					"Context/Resource/@x:token":  "a<b",
+					"Context/x:key":              "ENC[yyy]",
+					"Context/cdata":              "ENC[zzz]",
+					"Context/empty":              "a&b",
+				},
+			},
+			Expect: Expect{
+				Text: `<Context xmlns:x="urn:x">
+  <Resource name="jdbc/db" password='ENC[&apos;xxx&apos;]' x:token="a&lt;b"/>
+  <x:key>ENC[yyy]</x:key>
+  <cdata><![CDATA[ENC[zzz]]]></cdata>
+  <empty>a&amp;b</empty>
+</Context>
+`,
+			},
+		},
+		{
+			Title: "metadata is appended",
+			Input: Input{
+				Text: `<settings>
+    <password>secret</password>
+</settings>
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `<settings>
+    <password>secret</password>
+    <gipher><version>1.0</version></gipher>
+</settings>
+`,
+			},
+		},
+		{
+			Title: "self-closing element with attributes has no text",
+			Input: Input{
+				Text: `<Context xmlns:x="urn:x">
+  <Resource name="jdbc/x" password="p"/>
+  <Parameter name="a" value="b"></Parameter>
+</Context>
+`,
+				Values: map[string]interface{}{
+					"Context/Resource/@password": "ENC[xxx]",
+				},
+			},
+			Expect: Expect{
+				Values: map[string]interface{}{
+					"Context": map[string]interface{}{
+						"Resource": map[string]interface{}{
+							"@name":     "jdbc/x",
+							"@password": "p",
+						},
+						"Parameter": map[string]interface{}{
+							"@name":  "a",
+							"@value": "b",
+						},
+					},
+				},
+				Text: `<Context xmlns:x="urn:x">
+  <Resource name="jdbc/x" password="ENC[xxx]"/>
+  <Parameter name="a" value="b"></Parameter>
+</Context>
+`,
+			},
+		},
+		{
+			Title: "metadata is appended to a single line",
+			Input: Input{
+				Text: `<settings><password>secret</password></settings>`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `<settings><password>secret</password><gipher><version>1.0</version></gipher></settings>`,
+			},
+		},
+		{
+			Title: "metadata is appended to a self-closing root element",
+			Input: Input{
+				Text: `<settings id="a"/>
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `<settings id="a"><gipher><version>1.0</version></gipher></settings>
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `<settings>
+    <password>secret</password>
+    <gipher><version>1.0</version></gipher>
+</settings>
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `<settings>
+    <password>secret</password>
+</settings>
+`,
+			},
+		},
+		{
+			Title: "self-closing element cannot have a text",
+			Input: Input{
+				Text: `<settings><password/></settings>`,
+				Values: map[string]interface{}{
+					"settings/password": "ENC[xxx]",
+				},
+			},
+			Expect: Expect{
+				Error: `cannot write "settings/password" to xml: the element has no single text node`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("xml", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Values != nil {
+				assert.Equal(test.Expect.Values, acc.Unwrap())
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			err = c.encode(buf, acc)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
@@ -0,0 +1,887 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/morikuni/accessor"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlCodec keeps the source and the node tree of the document,
+// so that comments, key order, quoting style, anchors and document markers
+// are reproduced and only changed values are rewritten in the source on encoding.
+// a node shared by aliases or merge keys is rewritten once at its anchor, and aliases are left untouched.
+// encoding fails with errYAMLNotPatchable if changes cannot be written in place.
+//
+// a stream of several documents is a map keyed by the index of each document
+// (e.g. "1/data/password"), and the index is followed by the kind and the name
+// of kubernetes resources if documentNames is set (e.g. "1/Secret/db/data/password").
+// a single document has no index, and patterns selecting a document by its index are rejected by checkPattern.
+//
+// the metadata section is written as a comment at the end of the stream (e.g. `# gipher: {"mac":"..."}`),
+// so that documents such as kubernetes resources are not changed by it.
+// a single document which already has the section as a key keeps it there.
+type yamlCodec struct {
+	src           []byte
+	root          *yaml.Node
+	indent        int
+	documentNames bool
+	// docs are documents of a stream, nil for a single document.
+	docs []yamlDocument
+	// inlineMetadata is true if the metadata section is a key of a single document.
+	inlineMetadata bool
+}
+
+type yamlDocument struct {
+	node *yaml.Node
+	// keys are the keys of the document in the stream.
+	keys []string
+}
+
+func (c *yamlCodec) decode(input io.Reader) (accessor.Accessor, error) {
+	bs, err := readAllNotEmpty(input)
+	if err != nil {
+		return nil, err
+	}
+	bs, md, err := cutYAMLMetadata(bs)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	for {
+		node := &yaml.Node{}
+		err := dec.Decode(node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+	c.src = bs
+	c.indent = scanYAMLIndent(bs)
+	if len(nodes) <= 1 {
+		root := &yaml.Node{}
+		if len(nodes) == 1 {
+			root = nodes[0]
+		}
+		var obj interface{}
+		if root.Kind != 0 {
+			err = root.Decode(&obj)
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.root = root
+		if m, ok := obj.(map[string]interface{}); ok {
+			_, c.inlineMetadata = m[MetadataKey]
+			if md != nil {
+				if c.inlineMetadata {
+					return nil, fmt.Errorf("yaml has %q both as a key and as a comment", MetadataKey)
+				}
+				m[MetadataKey] = md
+			}
+		}
+		return accessor.NewAccessor(obj)
+	}
+
+	obj := make(map[string]interface{})
+	c.docs = make([]yamlDocument, 0, len(nodes))
+	for _, node := range nodes {
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		keys := []string{strconv.Itoa(len(c.docs))}
+		if c.documentNames {
+			keys = append(keys, kubernetesName(v)...)
+		}
+		m := obj
+		for _, k := range keys[:len(keys)-1] {
+			child := make(map[string]interface{})
+			m[k] = child
+			m = child
+		}
+		m[keys[len(keys)-1]] = v
+		c.docs = append(c.docs, yamlDocument{node, keys})
+	}
+	if md != nil {
+		obj[MetadataKey] = md
+	}
+	return accessor.NewAccessor(obj)
+}
+
+// yamlMetadataPrefix starts the comment holding the metadata section.
+const yamlMetadataPrefix = "# " + MetadataKey + ": "
+
+// cutYAMLMetadata removes the comment holding the metadata section from the end of bs,
+// and returns the section, or nil if there is no such comment.
+func cutYAMLMetadata(bs []byte) ([]byte, map[string]interface{}, error) {
+	body := bytes.TrimRight(bs, " \t\r\n")
+	start := bytes.LastIndexByte(body, '\n') + 1
+	line := body[start:]
+	if !bytes.HasPrefix(line, []byte(yamlMetadataPrefix)) {
+		return bs, nil, nil
+	}
+	var md map[string]interface{}
+	if err := json.Unmarshal(line[len(yamlMetadataPrefix):], &md); err != nil || md == nil {
+		return nil, nil, fmt.Errorf("invalid %q comment in yaml", MetadataKey)
+	}
+	return bs[:start], md, nil
+}
+
+// writeYAMLMetadata writes the metadata section as a comment.
+func writeYAMLMetadata(output io.Writer, md interface{}) error {
+	bs, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "%s%s\n", yamlMetadataPrefix, bs)
+	return err
+}
+
+// documentIndexPattern matches a pattern starting with the index of a document.
+var documentIndexPattern = regexp.MustCompile(`^\^?/?([0-9]+)/`)
+
+// checkPattern returns an error if pattern selects a document of a stream by its index
+// but the input is a single document, whose paths have no index.
+func (c *yamlCodec) checkPattern(acc accessor.Accessor, pattern string) error {
+	if c.docs != nil {
+		return nil
+	}
+	m := documentIndexPattern.FindStringSubmatch(pattern)
+	if m == nil {
+		return nil
+	}
+	// the index may be a key of the document, or an index of a sequence.
+	if path, err := accessor.ParsePath(m[1]); err == nil {
+		if _, err := acc.Get(path); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("pattern %q selects document %s of a yaml stream, but the input is a single document whose paths have no index", pattern, m[1])
+}
+
+// kubernetesName returns the kind and the name of a kubernetes resource,
+// or nil if v is not a resource.
+func kubernetesName(v interface{}) []string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	kind, _ := m["kind"].(string)
+	md, _ := m["metadata"].(map[string]interface{})
+	name, _ := md["name"].(string)
+	if kind == "" || name == "" || strings.Contains(kind, "/") || strings.Contains(name, "/") {
+		return nil
+	}
+	return []string{kind, name}
+}
+
+func (c *yamlCodec) encode(output io.Writer, acc accessor.Accessor) error {
+	obj := acc.Unwrap()
+	var md interface{}
+	if m, ok := obj.(map[string]interface{}); ok && !c.inlineMetadata {
+		md = m[MetadataKey]
+		obj = withoutMetadata(obj)
+	}
+
+	var (
+		bs  []byte
+		err error
+	)
+	switch {
+	case c.docs != nil:
+		bs, err = c.patchStream(obj)
+	case c.root == nil || c.root.Kind == 0:
+		bs, err = yaml.Marshal(obj)
+	default:
+		bs, err = c.patch([]*yaml.Node{c.root}, []interface{}{obj})
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := output.Write(bs); err != nil {
+		return err
+	}
+	if md != nil {
+		return writeYAMLMetadata(output, md)
+	}
+	return nil
+}
+
+// patchStream returns the source of a stream updated to represent value.
+func (c *yamlCodec) patchStream(value interface{}) ([]byte, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("yaml stream must be a map of documents")
+	}
+	nodes := make([]*yaml.Node, 0, len(c.docs))
+	values := make([]interface{}, 0, len(c.docs))
+	for _, doc := range c.docs {
+		var v interface{} = obj
+		for i, k := range doc.keys {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot write %q to yaml: documents of a stream cannot be changed", strings.Join(doc.keys[:i], "/"))
+			}
+			if v, ok = m[k]; !ok {
+				return nil, fmt.Errorf("cannot remove %q from yaml: documents of a stream cannot be changed", strings.Join(doc.keys[:i+1], "/"))
+			}
+		}
+		nodes = append(nodes, doc.node)
+		values = append(values, v)
+	}
+	return c.patch(nodes, values)
+}
+
+// patch returns the source updated so that nodes represent values.
+func (c *yamlCodec) patch(nodes []*yaml.Node, values []interface{}) ([]byte, error) {
+	p := &yamlPatcher{
+		src:     c.src,
+		indent:  c.indent,
+		edited:  make(map[*yaml.Node]bool),
+		anchors: make(map[*yaml.Node]yamlContext),
+	}
+	for i, node := range nodes {
+		if err := p.sync(node, values[i], yamlContext{indent: -1}); err != nil {
+			return nil, err
+		}
+	}
+	bs, ok := applyEdits(c.src, p.edits)
+	if !ok {
+		return nil, errYAMLNotPatchable
+	}
+	return bs, nil
+}
+
+// scanYAMLIndent detects the indent width of the document.
+func scanYAMLIndent(bs []byte) int {
+	indent := 0
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		indent = 2
+	}
+	return indent
+}
+
+var errYAMLNotPatchable = errors.New("yaml document cannot be rewritten without losing its layout")
+
+// yamlContext is where a node is written.
+type yamlContext struct {
+	// indent is the column of the collection holding the node, -1 for the root.
+	indent int
+	// flow is true inside a flow collection such as {a: 1} and [1, 2].
+	flow bool
+}
+
+// yamlPatcher collects edits of the source which update nodes to represent new values.
+type yamlPatcher struct {
+	src    []byte
+	indent int
+	edits  []textEdit
+	// edited are nodes already rewritten, so that a node shared by aliases
+	// or merge keys is rewritten only once.
+	edited map[*yaml.Node]bool
+	// anchors are contexts of anchored nodes, used when they are rewritten through an alias.
+	anchors map[*yaml.Node]yamlContext
+}
+
+// sync updates node to represent value, keeping parts of node which already represent it.
+func (p *yamlPatcher) sync(node *yaml.Node, value interface{}, ctx yamlContext) error {
+	if node.Anchor != "" {
+		p.anchors[node] = ctx
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			if value == nil {
+				return nil
+			}
+			return errYAMLNotPatchable
+		}
+		return p.sync(node.Content[0], value, ctx)
+	case yaml.AliasNode:
+		// the anchored node is rewritten instead of the alias, unless it already is.
+		if p.edited[node.Alias] || yamlNodeEquals(node.Alias, value) {
+			return nil
+		}
+		return p.sync(node.Alias, value, p.anchors[node.Alias])
+	case yaml.MappingNode:
+		if isMap(value) {
+			return p.syncMapping(node, value, ctx)
+		}
+	case yaml.SequenceNode:
+		if v, ok := value.([]interface{}); ok && len(v) == len(node.Content) {
+			return p.syncSequence(node, v, ctx)
+		}
+	}
+
+	if p.edited[node] || yamlNodeEquals(node, value) {
+		return nil
+	}
+	return p.replace(node, value, ctx)
+}
+
+func yamlNodeEquals(node *yaml.Node, value interface{}) bool {
+	var old interface{}
+	return node.Kind != 0 && node.Decode(&old) == nil && reflect.DeepEqual(old, value)
+}
+
+func isMap(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return true
+	}
+	return false
+}
+
+// replace rewrites the source of node by the representation of value, keeping comments and the anchor.
+// the quoting style is kept if both old and new values are strings.
+func (p *yamlPatcher) replace(node *yaml.Node, value interface{}, ctx yamlContext) error {
+	start, end, err := p.span(node, ctx)
+	if err != nil {
+		return err
+	}
+	n := &yaml.Node{}
+	if err := n.Encode(value); err != nil {
+		return err
+	}
+	quoted := yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.LiteralStyle | yaml.FoldedStyle
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" && node.Style&quoted != 0 &&
+		n.Kind == yaml.ScalarNode && n.ShortTag() == "!!str" {
+		n.Style = node.Style & quoted
+	}
+	text, err := p.render(n, ctx)
+	if err != nil {
+		return err
+	}
+	// an empty value such as "key:" has no source.
+	if start == end {
+		text = " " + text
+	}
+	p.edits = append(p.edits, textEdit{start, end, text})
+	p.edited[node] = true
+	return nil
+}
+
+// render returns the source of n written at ctx.
+// collections are written in flow style, so that they fit in the place of any node.
+func (p *yamlPatcher) render(n *yaml.Node, ctx yamlContext) (string, error) {
+	if n.Kind != yaml.ScalarNode {
+		n.Style = yaml.FlowStyle
+	} else if ctx.flow && n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		n.Style = yaml.DoubleQuotedStyle
+	}
+	bs, err := yaml.Marshal(n)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSuffix(string(bs), "\n")
+	if ctx.flow && strings.Contains(text, "\n") {
+		n.Style = yaml.DoubleQuotedStyle
+		if bs, err = yaml.Marshal(n); err != nil {
+			return "", err
+		}
+		text = strings.TrimSuffix(string(bs), "\n")
+	}
+	return p.reindent(text, ctx.indent+p.indent, false), nil
+}
+
+// reindent indents lines of text after the first by indent spaces, keeping their relative indentation.
+// the first line is indented too if all is true.
+func (p *yamlPatcher) reindent(text string, indent int, all bool) string {
+	if indent < 0 {
+		indent = 0
+	}
+	lines := strings.Split(text, "\n")
+	first := 1
+	if all {
+		first = 0
+	}
+	min := -1
+	for _, l := range lines[first:] {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " ")); min < 0 || n < min {
+			min = n
+		}
+	}
+	prefix := strings.Repeat(" ", indent)
+	for i := first; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = prefix + lines[i][min:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *yamlPatcher) syncSequence(node *yaml.Node, value []interface{}, ctx yamlContext) error {
+	child := yamlContext{indent: node.Column - 1, flow: ctx.flow || node.Style&yaml.FlowStyle != 0}
+	if child.flow {
+		child.indent = ctx.indent
+	}
+	for i, v := range value {
+		if err := p.sync(node.Content[i], v, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *yamlPatcher) syncMapping(node *yaml.Node, value interface{}, ctx yamlContext) error {
+	flow := ctx.flow || node.Style&yaml.FlowStyle != 0
+	values := make(map[string]interface{})
+	forEachMapEntry(value, func(k string, v interface{}) {
+		values[k] = v
+	})
+
+	var (
+		merged  []*yaml.Node
+		removed []int
+	)
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		if key.ShortTag() == "!!merge" {
+			merged = append(merged, mergedYAMLMappings(val)...)
+			continue
+		}
+		seen[key.Value] = true
+		v, ok := values[key.Value]
+		if !ok {
+			removed = append(removed, i)
+			continue
+		}
+		if err := p.sync(val, v, yamlContext{indent: key.Column - 1, flow: flow}); err != nil {
+			return err
+		}
+	}
+
+	// keys which are not in the mapping itself are merged from other mappings, or added.
+	var keys, added []string
+	for k := range values {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m, key, val := findMergedYAMLKey(merged, k)
+		if val == nil {
+			added = append(added, k)
+			continue
+		}
+		child := yamlContext{indent: key.Column - 1, flow: p.anchors[m].flow || m.Style&yaml.FlowStyle != 0}
+		if err := p.sync(val, values[k], child); err != nil {
+			return err
+		}
+	}
+
+	for i := len(removed) - 1; i >= 0; i-- {
+		if err := p.remove(node, removed[i], flow); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return p.add(node, added, values, ctx, flow)
+	}
+	return nil
+}
+
+// mergedYAMLMappings returns mappings merged by a merge key with val, in the order of precedence.
+func mergedYAMLMappings(val *yaml.Node) []*yaml.Node {
+	switch val.Kind {
+	case yaml.AliasNode:
+		return mergedYAMLMappings(val.Alias)
+	case yaml.MappingNode:
+		return []*yaml.Node{val}
+	case yaml.SequenceNode:
+		var ms []*yaml.Node
+		for _, n := range val.Content {
+			ms = append(ms, mergedYAMLMappings(n)...)
+		}
+		return ms
+	}
+	return nil
+}
+
+// findMergedYAMLKey returns the merged mapping, the key and the value of k, or nils if k is not merged.
+func findMergedYAMLKey(merged []*yaml.Node, k string) (m, key, val *yaml.Node) {
+	for _, m := range merged {
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i].ShortTag() != "!!merge" && m.Content[i].Value == k {
+				return m, m.Content[i], m.Content[i+1]
+			}
+		}
+		// merge keys of a merged mapping are merged too.
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i].ShortTag() == "!!merge" {
+				if mm, key, val := findMergedYAMLKey(mergedYAMLMappings(m.Content[i+1]), k); val != nil {
+					return mm, key, val
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func forEachMapEntry(m interface{}, fn func(k string, v interface{})) {
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			fn(k, v)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			fn(fmt.Sprint(k), v)
+		}
+	}
+}
+
+// remove removes the i-th pair of a mapping with the rest of its line.
+func (p *yamlPatcher) remove(node *yaml.Node, i int, flow bool) error {
+	key, val := node.Content[i], node.Content[i+1]
+	start := p.offset(key.Line, key.Column)
+	_, end, err := p.span(val, yamlContext{indent: key.Column - 1, flow: flow})
+	if err != nil {
+		return err
+	}
+	if flow {
+		// the comma after the pair is removed, or the one before it for the last pair.
+		if j := p.skipSpace(end, true); j < len(p.src) && p.src[j] == ',' {
+			end = p.skipSpace(j+1, true)
+		} else if j := bytes.LastIndexByte(p.src[:start], ','); j > node.Column && len(bytes.TrimSpace(p.src[j+1:start])) == 0 {
+			start = j
+		}
+		p.edits = append(p.edits, textEdit{start, end, ""})
+		return nil
+	}
+
+	lineStart := bytes.LastIndexByte(p.src[:start], '\n') + 1
+	if len(bytes.TrimSpace(p.src[lineStart:start])) != 0 {
+		return errYAMLNotPatchable
+	}
+	if j := bytes.IndexByte(p.src[end:], '\n'); j >= 0 {
+		end += j + 1
+	} else {
+		end = len(p.src)
+	}
+	p.edits = append(p.edits, textEdit{lineStart, end, ""})
+	return nil
+}
+
+// add appends pairs of keys to a mapping.
+func (p *yamlPatcher) add(node *yaml.Node, keys []string, values map[string]interface{}, ctx yamlContext, flow bool) error {
+	var pairs []string
+	for _, k := range keys {
+		n := &yaml.Node{}
+		if err := n.Encode(map[string]interface{}{k: values[k]}); err != nil {
+			return err
+		}
+		if flow {
+			n.Style = yaml.FlowStyle
+			bs, err := yaml.Marshal(n)
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(string(bs)), "{"), "}"))
+			continue
+		}
+		buf := &bytes.Buffer{}
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(p.indent)
+		if err := enc.Encode(n); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		first := node.Content[0]
+		pairs = append(pairs, p.reindent(strings.TrimSuffix(buf.String(), "\n"), first.Column-1, true))
+	}
+
+	start, end, err := p.span(node, ctx)
+	if err != nil {
+		return err
+	}
+	if flow && len(node.Content) == 0 {
+		p.edits = append(p.edits, textEdit{end - 1, end - 1, strings.Join(pairs, ", ")})
+		return nil
+	}
+	if start == end {
+		return errYAMLNotPatchable
+	}
+	last := node.Content[len(node.Content)-2]
+	if _, end, err = p.span(node.Content[len(node.Content)-1], yamlContext{indent: last.Column - 1, flow: flow}); err != nil {
+		return err
+	}
+	if flow {
+		p.edits = append(p.edits, textEdit{end, end, ", " + strings.Join(pairs, ", ")})
+		return nil
+	}
+	// pairs are added after the comment at the end of the last pair.
+	text := "\n" + strings.Join(pairs, "\n")
+	if j := bytes.IndexByte(p.src[end:], '\n'); j >= 0 {
+		end += j
+	} else {
+		end = len(p.src)
+	}
+	p.edits = append(p.edits, textEdit{end, end, text})
+	return nil
+}
+
+// offset returns the offset of a line and a column of the source, both starting with 1.
+// columns count characters, not bytes.
+func (p *yamlPatcher) offset(line, column int) int {
+	pos := 0
+	for i := 1; i < line && pos < len(p.src); i++ {
+		j := bytes.IndexByte(p.src[pos:], '\n')
+		if j < 0 {
+			return len(p.src)
+		}
+		pos += j + 1
+	}
+	for i := 1; i < column && pos < len(p.src) && p.src[pos] != '\n'; i++ {
+		_, size := utf8.DecodeRune(p.src[pos:])
+		pos += size
+	}
+	return pos
+}
+
+// skipSpace returns the offset of the first character after pos which is not a space.
+// line breaks and comments are skipped too if lines is true.
+func (p *yamlPatcher) skipSpace(pos int, lines bool) int {
+	for pos < len(p.src) {
+		switch p.src[pos] {
+		case ' ', '\t':
+			pos++
+		case '\r', '\n':
+			if !lines {
+				return pos
+			}
+			pos++
+		case '#':
+			if !lines {
+				return pos
+			}
+			for pos < len(p.src) && p.src[pos] != '\n' {
+				pos++
+			}
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// span returns the span of node in the source, excluding its anchor.
+// a node with no source, such as the value of "key:", has an empty span.
+func (p *yamlPatcher) span(node *yaml.Node, ctx yamlContext) (int, int, error) {
+	start := p.offset(node.Line, node.Column)
+	if node.Anchor != "" && start < len(p.src) && p.src[start] == '&' {
+		for start < len(p.src) && !strings.ContainsRune(" \t\r\n,[]{}", rune(p.src[start])) {
+			start++
+		}
+		start = p.skipSpace(start, true)
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		end, err := p.scalarEnd(node, start, ctx)
+		return start, end, err
+	case yaml.AliasNode:
+		return start, start + 1 + len(node.Value), nil
+	case yaml.MappingNode, yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			end, err := p.flowEnd(start)
+			return start, end, err
+		}
+		if len(node.Content) == 0 {
+			return start, start, nil
+		}
+		last := node.Content[len(node.Content)-1]
+		child := yamlContext{indent: node.Column - 1, flow: ctx.flow}
+		if node.Kind == yaml.MappingNode {
+			child.indent = node.Content[len(node.Content)-2].Column - 1
+		}
+		_, end, err := p.span(last, child)
+		return start, end, err
+	}
+	return 0, 0, errYAMLNotPatchable
+}
+
+// flowEnd returns the end of a flow collection starting at start.
+func (p *yamlPatcher) flowEnd(start int) (int, error) {
+	depth := 0
+	for pos := start; pos < len(p.src); pos++ {
+		switch c := p.src[pos]; c {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return pos + 1, nil
+			}
+		case '"', '\'':
+			end, err := p.quotedEnd(pos, c)
+			if err != nil {
+				return 0, err
+			}
+			pos = end - 1
+		case '#':
+			if pos > start && (p.src[pos-1] == ' ' || p.src[pos-1] == '\t') {
+				for pos < len(p.src) && p.src[pos] != '\n' {
+					pos++
+				}
+			}
+		}
+	}
+	return 0, errYAMLNotPatchable
+}
+
+// quotedEnd returns the end of a scalar quoted by quote starting at start.
+func (p *yamlPatcher) quotedEnd(start int, quote byte) (int, error) {
+	for pos := start + 1; pos < len(p.src); pos++ {
+		switch {
+		case quote == '"' && p.src[pos] == '\\':
+			pos++
+		case p.src[pos] == quote:
+			// a quote is escaped by another quote in single-quoted scalars.
+			if quote == '\'' && pos+1 < len(p.src) && p.src[pos+1] == '\'' {
+				pos++
+				continue
+			}
+			return pos + 1, nil
+		}
+	}
+	return 0, errYAMLNotPatchable
+}
+
+func (p *yamlPatcher) scalarEnd(node *yaml.Node, start int, ctx yamlContext) (int, error) {
+	if start >= len(p.src) {
+		return start, nil
+	}
+	switch c := p.src[start]; {
+	case c == '"' || c == '\'':
+		return p.quotedEnd(start, c)
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return p.blockEnd(start, ctx), nil
+	case node.Tag == "!!null" && node.Value == "" && (c == '\n' || c == '\r' || c == '#' || c == ' '):
+		return start, nil
+	}
+
+	// a plain scalar may continue over lines, which are folded into spaces.
+	end := p.plainEnd(start, ctx.flow)
+	folded := string(p.src[start:end])
+	breaks := 0
+	for pos := end; folded != node.Value && len(folded) < len(node.Value); {
+		j := bytes.IndexByte(p.src[pos:], '\n')
+		if j < 0 {
+			break
+		}
+		pos += j + 1
+		lineStart := p.skipSpace(pos, false)
+		if lineStart >= len(p.src) || p.src[lineStart] == '\n' || p.src[lineStart] == '\r' {
+			breaks++
+			continue
+		}
+		if lineStart-pos <= ctx.indent && !ctx.flow || p.src[lineStart] == '#' {
+			break
+		}
+		if breaks == 0 {
+			folded += " "
+		}
+		folded += strings.Repeat("\n", breaks)
+		breaks = 0
+		end = p.plainEnd(lineStart, ctx.flow)
+		folded += string(p.src[lineStart:end])
+		pos = end
+	}
+	if folded != node.Value {
+		return 0, errYAMLNotPatchable
+	}
+	return end, nil
+}
+
+// plainEnd returns the end of a plain scalar on the line of start.
+func (p *yamlPatcher) plainEnd(start int, flow bool) int {
+	end := start
+	for pos := start; pos < len(p.src); pos++ {
+		c := p.src[pos]
+		if c == '\n' || c == '\r' {
+			break
+		}
+		if c == '#' && pos > start && (p.src[pos-1] == ' ' || p.src[pos-1] == '\t') {
+			break
+		}
+		if c == ':' && (pos+1 == len(p.src) || strings.ContainsRune(" \t\r\n", rune(p.src[pos+1])) ||
+			flow && strings.ContainsRune(",[]{}", rune(p.src[pos+1]))) {
+			break
+		}
+		if flow && strings.ContainsRune(",[]{}", rune(c)) {
+			break
+		}
+		if c != ' ' && c != '\t' {
+			end = pos + 1
+		}
+	}
+	return end
+}
+
+// blockEnd returns the end of a literal or folded scalar starting at start,
+// which is the end of its last line indented more than the collection holding it.
+func (p *yamlPatcher) blockEnd(start int, ctx yamlContext) int {
+	end := bytes.IndexByte(p.src[start:], '\n')
+	if end < 0 {
+		return len(p.src)
+	}
+	end += start
+	for pos := end + 1; pos < len(p.src); {
+		lineEnd := bytes.IndexByte(p.src[pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(p.src)
+		} else {
+			lineEnd += pos
+		}
+		line := p.src[pos:lineEnd]
+		if len(bytes.TrimSpace(line)) > 0 {
+			indent := len(line) - len(bytes.TrimLeft(line, " "))
+			if indent <= ctx.indent || bytes.HasPrefix(line, []byte("---")) || bytes.HasPrefix(line, []byte("...")) {
+				break
+			}
+			end = bytes.LastIndexFunc(p.src[:lineEnd], func(r rune) bool { return r != ' ' && r != '\t' && r != '\r' }) + 1
+		}
+		pos = lineEnd + 1
+	}
+	return end
+}
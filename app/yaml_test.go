@@ -0,0 +1,717 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/morikuni/accessor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYAMLCodec(t *testing.T) {
+	type Input struct {
+		Text   string
+		Values map[string]interface{}
+	}
+	type Expect struct {
+		Text string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "nothing changed",
+			Input: Input{
+				Text: `---
+# database settings
+database:
+  user: 'admin' # login user
+  password: "secret"
+  port: 5432
+defaults: &defaults
+  timeout: 30
+service:
+  <<: *defaults
+  name: api
+`,
+			},
+			Expect: Expect{
+				Text: `---
+# database settings
+database:
+  user: 'admin' # login user
+  password: "secret"
+  port: 5432
+defaults: &defaults
+  timeout: 30
+service:
+  <<: *defaults
+  name: api
+`,
+			},
+		},
+		{
+			Title: "only changed values are rewritten",
+			Input: Input{
+				Text: `zebra: 1
+# the password
+password: "secret" # keep me
+apple:
+    - a
+    - b
+`,
+				Values: map[string]interface{}{
+					"password": "ENC[xxx]",
+					"apple/1":  "c",
+				},
+			},
+			Expect: Expect{
+				Text: `zebra: 1
+# the password
+password: "ENC[xxx]" # keep me
+apple:
+    - a
+    - c
+`,
+			},
+		},
+		{
+			Title: "aliases are left untouched",
+			Input: Input{
+				Text: `admin: &admin s3cret # the admin
+backup: *admin
+`,
+				Values: map[string]interface{}{
+					"admin":  "ENC[xxx]",
+					"backup": "ENC[yyy]",
+				},
+			},
+			Expect: Expect{
+				Text: `admin: &admin ENC[xxx] # the admin
+backup: *admin
+`,
+			},
+		},
+		{
+			Title: "anchored node is changed through an alias",
+			Input: Input{
+				Text: `admin: &admin s3cret
+backup: *admin
+`,
+				Values: map[string]interface{}{
+					"backup": "ENC[yyy]",
+				},
+			},
+			Expect: Expect{
+				Text: `admin: &admin ENC[yyy]
+backup: *admin
+`,
+			},
+		},
+		{
+			Title: "merged keys are not written",
+			Input: Input{
+				Text: `defaults: &defaults
+  password: changeme
+  timeout: 30
+database:
+  <<: *defaults
+  host: db
+`,
+				Values: map[string]interface{}{
+					"defaults/password": "ENC[xxx]",
+					"database/password": "ENC[yyy]",
+				},
+			},
+			Expect: Expect{
+				Text: `defaults: &defaults
+  password: ENC[xxx]
+  timeout: 30
+database:
+  <<: *defaults
+  host: db
+`,
+			},
+		},
+		{
+			Title: "block and flow scalars",
+			Input: Input{
+				Text: `tls: |
+  line1
+  line2
+flow: {user: admin, password: 'secret'}
+list: [a, "b"]
+folded: a
+  b # comment
+`,
+				Values: map[string]interface{}{
+					"tls":           "ENC[xxx]",
+					"flow/password": "a\nb",
+					"list/1":        "ENC[yyy]",
+					"folded":        "ENC[zzz]",
+				},
+			},
+			Expect: Expect{
+				Text: `tls: |-
+  ENC[xxx]
+flow: {user: admin, password: "a\nb"}
+list: [a, "ENC[yyy]"]
+folded: ENC[zzz] # comment
+`,
+			},
+		},
+		{
+			Title: "keys are added",
+			Input: Input{
+				Text: `a: 1 # one
+gipher:
+  mac: "00"
+  version: "1"
+b: {c: 1}
+`,
+				Values: map[string]interface{}{
+					"gipher/mac_key": "xxx",
+					"b/d":            2,
+				},
+			},
+			Expect: Expect{
+				Text: `a: 1 # one
+gipher:
+  mac: "00"
+  version: "1"
+  mac_key: xxx
+b: {c: 1, d: 2}
+`,
+			},
+		},
+		{
+			Title: "type is changed",
+			Input: Input{
+				Text: `age: "aW50OjE4"
+`,
+				Values: map[string]interface{}{
+					"age": int64(18),
+				},
+			},
+			Expect: Expect{
+				Text: `age: 18
+`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("yaml", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestYAMLStream(t *testing.T) {
+	type Input struct {
+		Text          string
+		DocumentNames bool
+		Values        map[string]interface{}
+		Metadata      map[string]interface{}
+		Strip         bool
+	}
+	type Expect struct {
+		Paths []string
+		Text  string
+		Error string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	manifests := `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+stringData:
+  password: secret
+---
+# the config
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  user: admin
+---
+- a
+`
+
+	table := []Test{
+		{
+			Title: "paths are prefixed by the index",
+			Input: Input{
+				Text: manifests,
+				Values: map[string]interface{}{
+					"0/stringData/password": "ENC[xxx]",
+					"2/0":                   "b",
+				},
+			},
+			Expect: Expect{
+				Paths: []string{"0/apiVersion", "1/data/user", "2/0"},
+				Text: `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+stringData:
+  password: ENC[xxx]
+---
+# the config
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  user: admin
+---
+- b
+`,
+			},
+		},
+		{
+			Title: "paths are prefixed by the kind and the name",
+			Input: Input{
+				Text:          manifests,
+				DocumentNames: true,
+				Values: map[string]interface{}{
+					"0/Secret/db/stringData/password": "ENC[xxx]",
+					"1/ConfigMap/app/data/user":       "root",
+				},
+			},
+			Expect: Expect{
+				Paths: []string{"0/Secret/db/stringData/password", "1/ConfigMap/app/data/user", "2/0"},
+				Text: `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+stringData:
+  password: ENC[xxx]
+---
+# the config
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  user: root
+---
+- a
+`,
+			},
+		},
+		{
+			Title: "metadata is written as a comment",
+			Input: Input{
+				Text: `---
+a: 1
+---
+b: 2
+`,
+				Metadata: map[string]interface{}{
+					"version": "1.0",
+				},
+			},
+			Expect: Expect{
+				Text: `---
+a: 1
+---
+b: 2
+# gipher: {"version":"1.0"}
+`,
+			},
+		},
+		{
+			Title: "metadata is stripped",
+			Input: Input{
+				Text: `a: 1
+---
+b: 2
+# gipher: {"version":"1.0"}
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Paths: []string{"0/a", "1/b", "gipher/version"},
+				Text: `a: 1
+---
+b: 2
+`,
+			},
+		},
+		{
+			Title: "metadata is removed from a single document",
+			Input: Input{
+				Text: `a: 1
+gipher:
+  mac: "00" # the mac
+b: 2
+`,
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `a: 1
+b: 2
+`,
+			},
+		},
+		{
+			Title: "a document is replaced",
+			Input: Input{
+				Text: `a: 1
+---
+b: 2
+`,
+				Values: map[string]interface{}{
+					"1": nil,
+				},
+				Strip: true,
+			},
+			Expect: Expect{
+				Text: `a: 1
+---
+null
+`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("yaml", codecOptions{documentNames: test.Input.DocumentNames}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Paths != nil {
+				paths := make(map[string]bool)
+				assert.Nil(acc.Foreach(func(path accessor.Path, _ interface{}) error {
+					paths[strings.Trim(path.String(), "/")] = true
+					return nil
+				}))
+				for _, p := range test.Expect.Paths {
+					assert.True(paths[p], p)
+				}
+			}
+			for p, v := range test.Input.Values {
+				assert.Nil(acc.Set(mustParsePath(t, p), v))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+			if test.Input.Strip {
+				acc, err = accessor.NewAccessor(withoutMetadata(acc.Unwrap()))
+				assert.Nil(err)
+			}
+
+			buf := &bytes.Buffer{}
+			err = c.encode(buf, acc)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestYAMLMetadata(t *testing.T) {
+	type Input struct {
+		Text     string
+		Metadata map[string]interface{}
+	}
+	type Expect struct {
+		Metadata map[string]interface{}
+		Text     string
+		Error    string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "written as a comment",
+			Input: Input{
+				Text: `kind: Secret
+stringData:
+  password: ENC[xxx]
+`,
+				Metadata: map[string]interface{}{
+					"mac": "00",
+				},
+			},
+			Expect: Expect{
+				Text: `kind: Secret
+stringData:
+  password: ENC[xxx]
+# gipher: {"mac":"00"}
+`,
+			},
+		},
+		{
+			Title: "read from a comment",
+			Input: Input{
+				Text: `kind: Secret
+# gipher: {"mac":"00"}
+`,
+			},
+			Expect: Expect{
+				Metadata: map[string]interface{}{
+					"mac": "00",
+				},
+				Text: `kind: Secret
+# gipher: {"mac":"00"}
+`,
+			},
+		},
+		{
+			Title: "kept as a key",
+			Input: Input{
+				Text: `a: 1
+gipher:
+  mac: "00"
+`,
+				Metadata: map[string]interface{}{
+					"mac": "01",
+				},
+			},
+			Expect: Expect{
+				Text: `a: 1
+gipher:
+  mac: "01"
+`,
+			},
+		},
+		{
+			Title: "both a key and a comment",
+			Input: Input{
+				Text: `gipher:
+  mac: "00"
+# gipher: {"mac":"00"}
+`,
+			},
+			Expect: Expect{
+				Error: `yaml has "gipher" both as a key and as a comment`,
+			},
+		},
+		{
+			Title: "invalid comment",
+			Input: Input{
+				Text: `a: 1
+# gipher: {"mac":
+`,
+			},
+			Expect: Expect{
+				Error: `invalid "gipher" comment in yaml`,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("yaml", codecOptions{}, strings.NewReader(test.Input.Text))
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			if !assert.Nil(err) {
+				return
+			}
+			if test.Expect.Metadata != nil {
+				assert.Equal(test.Expect.Metadata, getMetadata(acc))
+			}
+			if test.Input.Metadata != nil {
+				assert.Nil(setMetadata(acc, test.Input.Metadata))
+			}
+
+			buf := &bytes.Buffer{}
+			assert.Nil(c.encode(buf, acc))
+			assert.Equal(test.Expect.Text, buf.String())
+		})
+	}
+}
+
+func TestYAMLCheckPattern(t *testing.T) {
+	type Input struct {
+		Text    string
+		Pattern string
+	}
+	type Expect struct {
+		Error string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "index of a stream",
+			Input: Input{
+				Text:    "a: 1\n---\nb: 2\n",
+				Pattern: "^1/b",
+			},
+		},
+		{
+			Title: "index of a single document",
+			Input: Input{
+				Text:    "data:\n  password: secret\n",
+				Pattern: "0/data/password",
+			},
+			Expect: Expect{
+				Error: `pattern "0/data/password" selects document 0 of a yaml stream, but the input is a single document whose paths have no index`,
+			},
+		},
+		{
+			Title: "index of a sequence",
+			Input: Input{
+				Text:    "- password: secret\n",
+				Pattern: "^0/password",
+			},
+		},
+		{
+			Title: "no index",
+			Input: Input{
+				Text:    "data:\n  password: secret\n",
+				Pattern: "data/password",
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			acc, c, err := decodeToAccessor("yaml", codecOptions{}, strings.NewReader(test.Input.Text))
+			if !assert.Nil(err) {
+				return
+			}
+			err = c.(*yamlCodec).checkPattern(acc, test.Input.Pattern)
+			if test.Expect.Error != "" {
+				assert.EqualError(err, test.Expect.Error)
+				return
+			}
+			assert.Nil(err)
+		})
+	}
+}
+
+func TestYAMLHelmValues(t *testing.T) {
+	assert := assert.New(t)
+
+	values := `# Default values for api.
+replicaCount: 2
+
+image:
+  repository: registry.example.com/api
+  tag: "1.4.2"
+  pullPolicy: IfNotPresent
+
+defaults: &defaults
+  password: changeme
+  timeout: 30
+
+database:
+  <<: *defaults
+  host: db.internal
+
+adminPassword: &admin 's3cret'
+backupPassword: *admin
+
+ingress:
+  hosts:
+  - api.example.com
+  - www.example.com
+
+env:
+- name: TOKEN
+  value: abc   # the token
+
+tls: |
+  -----BEGIN CERTIFICATE-----
+  MIIB
+  -----END CERTIFICATE-----
+`
+	encryptedValues := `# Default values for api.
+replicaCount: 2
+
+image:
+  repository: registry.example.com/api
+  tag: "1.4.2"
+  pullPolicy: IfNotPresent
+
+defaults: &defaults
+  password: ENC[x]
+  timeout: 30
+
+database:
+  <<: *defaults
+  host: db.internal
+
+adminPassword: &admin 'ENC[x]'
+backupPassword: *admin
+
+ingress:
+  hosts:
+  - api.example.com
+  - www.example.com
+
+env:
+- name: TOKEN
+  value: ENC[x]   # the token
+
+tls: |-
+  ENC[x]
+`
+
+	os.Setenv("GIPHER_PASSWORD", "aaaa")
+	defer os.Unsetenv("GIPHER_PASSWORD")
+
+	args := []string{"gipher", "encrypt", "--format", "yaml", "--marker", "--pattern", "(?i)(password|value|tls)$"}
+	encrypted := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode := NewApp().Run(args, strings.NewReader(values), encrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Equal(encryptedValues, regexp.MustCompile(`ENC\[[^\]]+\]`).ReplaceAllString(encrypted.String(), "ENC[x]"))
+
+	args[1] = "decrypt"
+	decrypted := &bytes.Buffer{}
+	exitCode = NewApp().Run(args, bytes.NewReader(encrypted.Bytes()), decrypted, stderr)
+	assert.Equal(0, exitCode)
+	assert.Equal("", stderr.String())
+	assert.Equal(values, decrypted.String())
+}
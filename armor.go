@@ -0,0 +1,123 @@
+package gipher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	armorBegin     = "-----BEGIN GIPHER ENCRYPTED DATA-----"
+	armorEnd       = "-----END GIPHER ENCRYPTED DATA-----"
+	armorLineWidth = 64
+)
+
+var ErrInvalidArmor = errors.New("invalid armored data")
+
+// IsArmored reports whether data starts like the output of NewArmorWriter.
+func IsArmored(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(armorBegin))
+}
+
+type armorWriter struct {
+	w      io.Writer
+	column int
+}
+
+func (w *armorWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		m := armorLineWidth - w.column
+		if m > len(p) {
+			m = len(p)
+		}
+		if _, err := w.w.Write(p[:m]); err != nil {
+			return n, err
+		}
+		n += m
+		p = p[m:]
+		w.column += m
+		if w.column == armorLineWidth {
+			if _, err := io.WriteString(w.w, "\n"); err != nil {
+				return n, err
+			}
+			w.column = 0
+		}
+	}
+	return n, nil
+}
+
+type armorEncoder struct {
+	io.WriteCloser
+	w *armorWriter
+}
+
+func (e armorEncoder) Close() error {
+	if err := e.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if e.w.column > 0 {
+		if _, err := io.WriteString(e.w.w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(e.w.w, armorEnd+"\n")
+	return err
+}
+
+// NewArmorWriter returns a writer encoding data written to it into w as
+// base64 text enclosed by BEGIN/END lines.
+// Close must be called to write the end of the data. It does not close w.
+func NewArmorWriter(w io.Writer) (io.WriteCloser, error) {
+	if _, err := io.WriteString(w, armorBegin+"\n"); err != nil {
+		return nil, err
+	}
+	aw := &armorWriter{w: w}
+	return armorEncoder{base64.NewEncoder(base64.StdEncoding, aw), aw}, nil
+}
+
+type armorReader struct {
+	r       *bufio.Reader
+	pending string
+	done    bool
+}
+
+func (r *armorReader) Read(p []byte) (int, error) {
+	for r.pending == "" {
+		if r.done {
+			return 0, io.EOF
+		}
+		line, err := r.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		line = strings.TrimSpace(line)
+		if line == armorEnd {
+			r.done = true
+			continue
+		}
+		if err == io.EOF && line == "" {
+			return 0, ErrInvalidArmor
+		}
+		r.pending = line
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// NewArmorReader returns a reader decoding data written by NewArmorWriter.
+func NewArmorReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if strings.TrimSpace(line) != armorBegin {
+		return nil, ErrInvalidArmor
+	}
+	return base64.NewDecoder(base64.StdEncoding, &armorReader{r: br}), nil
+}
@@ -0,0 +1,68 @@
+package gipher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArmor(t *testing.T) {
+	type Input struct {
+		Data string
+	}
+	type Test struct {
+		Title string
+		Input Input
+	}
+
+	table := []Test{
+		{
+			Title: "empty",
+			Input: Input{""},
+		},
+		{
+			Title: "short",
+			Input: Input{"\x00\x01\x02"},
+		},
+		{
+			Title: "just one line",
+			Input: Input{strings.Repeat("a", 48)},
+		},
+		{
+			Title: "several lines",
+			Input: Input{strings.Repeat("\xff\x00", 1000)},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf := &bytes.Buffer{}
+			w, err := NewArmorWriter(buf)
+			assert.Nil(err)
+			_, err = w.Write([]byte(test.Input.Data))
+			assert.Nil(err)
+			assert.Nil(w.Close())
+
+			assert.True(IsArmored(buf.Bytes()))
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				assert.True(len(line) <= armorLineWidth || strings.HasPrefix(line, "-----"))
+			}
+
+			r, err := NewArmorReader(bytes.NewReader(buf.Bytes()))
+			assert.Nil(err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(err)
+			assert.Equal(test.Input.Data, string(data))
+
+			r, err = NewArmorReader(strings.NewReader(strings.TrimSuffix(buf.String(), armorEnd+"\n")))
+			assert.Nil(err)
+			_, err = ioutil.ReadAll(r)
+			assert.Equal(ErrInvalidArmor, err)
+		})
+	}
+}
@@ -1,34 +1,283 @@
 package gipher
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
 )
 
+var ErrInvalidEnvelope = errors.New("invalid ciphertext encrypted with a data key")
+
+// AWSKMSOptions configures a cryptor using aws kms.
+type AWSKMSOptions struct {
+	Region string
+	KeyID  string
+
+	// Endpoint overrides the kms endpoint (e.g. a local kms for testing).
+	Endpoint string
+
+	// Profile selects a profile of the shared config instead of AWS_PROFILE.
+	Profile string
+
+	// RoleARN is a role assumed before calling kms.
+	// ExternalID and SessionName are used only when RoleARN is set.
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+
+	// Retry is applied to throttled or temporarily failed kms calls.
+	Retry RetryPolicy
+
+	// DataKey enables envelope encryption: a data key is generated by kms once
+	// and values are encrypted locally with it.
+	// Decrypt accepts both forms regardless of this option.
+	DataKey bool
+
+	// Cache holds unwrapped data keys so that values encrypted with the same
+	// data key cost only one kms call. nil disables caching.
+	Cache *DataKeyCache
+}
+
 type awsKMSCryptor struct {
-	keyID string
-	kms   *kms.KMS
+	// retries is accessed atomically and must be the first field for 64-bit alignment.
+	retries int64
+	keyID   string
+	kms     kmsiface.KMSAPI
+	retry   RetryPolicy
+	sleep   func(time.Duration)
+	useKey  bool
+	cache   *DataKeyCache
+
+	mu         sync.Mutex
+	dataKey    []byte
+	wrappedKey []byte
 }
 
 func NewAWSKMSCryptor(region string, keyID string) (Cryptor, error) {
+	return NewAWSKMSCryptorWithOptions(AWSKMSOptions{
+		Region: region,
+		KeyID:  keyID,
+		Retry:  DefaultRetryPolicy,
+	})
+}
+
+func NewAWSKMSCryptorWithOptions(opts AWSKMSOptions) (Cryptor, error) {
 	session, err := session.NewSessionWithOptions(session.Options{
 		Config: aws.Config{
-			Region: aws.String(region),
+			Region: aws.String(opts.Region),
 		},
+		Profile:           opts.Profile,
 		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
 		return nil, err
 	}
-	kms := kms.New(session)
-	return awsKMSCryptor{keyID, kms}, nil
+	return NewAWSKMSCryptorWithClient(kms.New(session, awsKMSConfig(session, opts)), opts), nil
+}
+
+// awsKMSConfig returns the config of the kms client.
+// the endpoint is set only to the kms client, so that sts calls to assume the role
+// are not sent to it.
+func awsKMSConfig(session *session.Session, opts AWSKMSOptions) *aws.Config {
+	// the sdk does not retry by itself, so that retries follow opts.Retry and are counted.
+	config := aws.NewConfig().WithMaxRetries(0)
+	if opts.Endpoint != "" {
+		config = config.WithEndpoint(opts.Endpoint)
+	}
+	if opts.RoleARN != "" {
+		creds := stscreds.NewCredentials(session, opts.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if opts.ExternalID != "" {
+				p.ExternalID = aws.String(opts.ExternalID)
+			}
+			if opts.SessionName != "" {
+				p.RoleSessionName = opts.SessionName
+			}
+		})
+		config = config.WithCredentials(creds)
+	}
+	return config
+}
+
+// NewAWSKMSCryptorWithClient returns a cryptor calling kms through client.
+// Region, Endpoint, Profile and the role of opts are ignored since the client is already configured.
+func NewAWSKMSCryptorWithClient(client kmsiface.KMSAPI, opts AWSKMSOptions) Cryptor {
+	return &awsKMSCryptor{
+		keyID:  opts.KeyID,
+		kms:    client,
+		retry:  opts.Retry,
+		sleep:  time.Sleep,
+		useKey: opts.DataKey,
+		cache:  opts.Cache,
+	}
+}
+
+var retryableAWSErrorCodes = map[string]bool{
+	"Throttling":                  true,
+	"ThrottlingException":         true,
+	"RequestLimitExceeded":        true,
+	"KMSInternalException":        true,
+	"DependencyTimeoutException":  true,
+	"ServiceUnavailableException": true,
+	"InternalFailure":             true,
+}
+
+func isRetryableAWSError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return retryableAWSErrorCodes[aerr.Code()]
+	}
+	return false
+}
+
+func (c *awsKMSCryptor) do(fn func() error) error {
+	retries, err := c.retry.do(isRetryableAWSError, c.sleep, fn)
+	atomic.AddInt64(&c.retries, int64(retries))
+	return err
+}
+
+func (c *awsKMSCryptor) Retries() int {
+	return int(atomic.LoadInt64(&c.retries))
+}
+
+// envelopeMagic prefixes values encrypted with a data key.
+// it never collides with kms ciphertext blobs, which start with a version byte of 1.
+var envelopeMagic = []byte("\x00gipher-dk1")
+
+// generateDataKey returns the data key of c, generating it at the first call.
+func (c *awsKMSCryptor) generateDataKey() ([]byte, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dataKey != nil {
+		return c.dataKey, c.wrappedKey, nil
+	}
+
+	var r *kms.GenerateDataKeyOutput
+	err := c.do(func() (err error) {
+		r, err = c.kms.GenerateDataKey(&kms.GenerateDataKeyInput{
+			KeyId:   aws.String(c.keyID),
+			KeySpec: aws.String(kms.DataKeySpecAes256),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	c.dataKey, c.wrappedKey = r.Plaintext, r.CiphertextBlob
+	c.cache.Put(c.wrappedKey, c.dataKey)
+	return c.dataKey, c.wrappedKey, nil
+}
+
+// unwrapDataKey returns the data key of wrappedKey from the cache or kms.
+func (c *awsKMSCryptor) unwrapDataKey(wrappedKey []byte) ([]byte, error) {
+	return c.cache.Load(wrappedKey, func() ([]byte, error) {
+		var r *kms.DecryptOutput
+		err := c.do(func() (err error) {
+			r, err = c.kms.Decrypt(&kms.DecryptInput{
+				CiphertextBlob: wrappedKey,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return r.Plaintext, nil
+	})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot accept the data key: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealEnvelope encrypts text with the data key.
+// the format is: magic | length of wrapped key (2 bytes) | wrapped key | nonce | sealed text.
+func (c *awsKMSCryptor) sealEnvelope(text string) ([]byte, error) {
+	key, wrappedKey, err := c.generateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(envelopeMagic) + 2 + len(wrappedKey)
+	buf := make([]byte, header+aead.NonceSize())
+	copy(buf, envelopeMagic)
+	binary.BigEndian.PutUint16(buf[len(envelopeMagic):], uint16(len(wrappedKey)))
+	copy(buf[len(envelopeMagic)+2:], wrappedKey)
+	nonce := buf[header:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(buf, nonce, []byte(text), buf[:header]), nil
+}
+
+func (c *awsKMSCryptor) openEnvelope(ciphertext []byte) (string, error) {
+	rest := ciphertext[len(envelopeMagic):]
+	if len(rest) < 2 {
+		return "", ErrInvalidEnvelope
+	}
+	n := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+n {
+		return "", ErrInvalidEnvelope
+	}
+	header := len(envelopeMagic) + 2 + n
+	wrappedKey := ciphertext[len(envelopeMagic)+2 : header]
+
+	key, err := c.unwrapDataKey(wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	rest = ciphertext[header:]
+	if len(rest) < aead.NonceSize() {
+		return "", ErrInvalidEnvelope
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], ciphertext[:header])
+	if err != nil {
+		return "", ErrInvalidEnvelope
+	}
+	return string(plaintext), nil
 }
 
-func (c awsKMSCryptor) Encrypt(text string) (Ciphertext, error) {
-	r, err := c.kms.Encrypt(&kms.EncryptInput{
-		KeyId:     aws.String(c.keyID),
-		Plaintext: []byte(text),
+func (c *awsKMSCryptor) Encrypt(text string) (Ciphertext, error) {
+	if c.useKey {
+		ciphertext, err := c.sealEnvelope(text)
+		if err != nil {
+			return nil, err
+		}
+		return EncodeCiphertext(ciphertext), nil
+	}
+
+	var r *kms.EncryptOutput
+	err := c.do(func() (err error) {
+		r, err = c.kms.Encrypt(&kms.EncryptInput{
+			KeyId:     aws.String(c.keyID),
+			Plaintext: []byte(text),
+		})
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -36,14 +285,21 @@ func (c awsKMSCryptor) Encrypt(text string) (Ciphertext, error) {
 	return EncodeCiphertext(r.CiphertextBlob), nil
 }
 
-func (c awsKMSCryptor) Decrypt(text Ciphertext) (string, error) {
+func (c *awsKMSCryptor) Decrypt(text Ciphertext) (string, error) {
 	ciphertext, err := DecodeCiphertext(text)
 	if err != nil {
 		return "", err
 	}
+	if bytes.HasPrefix(ciphertext, envelopeMagic) {
+		return c.openEnvelope(ciphertext)
+	}
 
-	r, err := c.kms.Decrypt(&kms.DecryptInput{
-		CiphertextBlob: ciphertext,
+	var r *kms.DecryptOutput
+	err = c.do(func() (err error) {
+		r, err = c.kms.Decrypt(&kms.DecryptInput{
+			CiphertextBlob: ciphertext,
+		})
+		return err
 	})
 	if err != nil {
 		return "", err
@@ -0,0 +1,205 @@
+package gipher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/morikuni/gipher/fakekms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAWSKMSCryptor(t *testing.T) {
+	type Input struct {
+		Plaintext string
+		Errors    []error
+	}
+	type Expect struct {
+		Retries int
+		Err     error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	fatal := errors.New("fatal")
+	quota := awserr.New(kms.ErrCodeLimitExceededException, "quota exceeded", nil)
+
+	table := []Test{
+		{
+			Title: "success",
+			Input: Input{
+				Plaintext: "hello world",
+			},
+			Expect: Expect{
+				Retries: 0,
+				Err:     nil,
+			},
+		},
+		{
+			Title: "success after throttling",
+			Input: Input{
+				Plaintext: "hello world",
+				Errors:    []error{fakekms.ThrottlingError(), fakekms.ThrottlingError()},
+			},
+			Expect: Expect{
+				Retries: 2,
+				Err:     nil,
+			},
+		},
+		{
+			Title: "not retryable",
+			Input: Input{
+				Plaintext: "hello world",
+				Errors:    []error{fakekms.ThrottlingError(), fatal},
+			},
+			Expect: Expect{
+				Retries: 1,
+				Err:     fatal,
+			},
+		},
+		{
+			Title: "quota is not throttling",
+			Input: Input{
+				Plaintext: "hello world",
+				Errors:    []error{quota},
+			},
+			Expect: Expect{
+				Retries: 0,
+				Err:     quota,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			kms := fakekms.New("alias/test")
+			for _, err := range test.Input.Errors {
+				kms.InjectError(err)
+			}
+			cryptor := NewAWSKMSCryptorWithClient(kms, AWSKMSOptions{
+				KeyID: "alias/test",
+				Retry: RetryPolicy{
+					MaxAttempts: 3,
+					BaseDelay:   time.Millisecond,
+					MaxDelay:    time.Millisecond,
+				},
+			})
+
+			cipher, err := cryptor.Encrypt(test.Input.Plaintext)
+			assert.Equal(test.Expect.Err, err)
+			assert.Equal(test.Expect.Retries, cryptor.(RetryCounter).Retries())
+			if err != nil {
+				return
+			}
+
+			text, err := cryptor.Decrypt(cipher)
+			assert.Nil(err)
+			assert.Equal(test.Input.Plaintext, text)
+		})
+	}
+}
+
+func TestAWSKMSCryptorDataKey(t *testing.T) {
+	type Input struct {
+		Cache *DataKeyCache
+	}
+	type Expect struct {
+		DecryptCalls int
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "without cache",
+			Input: Input{
+				Cache: nil,
+			},
+			Expect: Expect{
+				DecryptCalls: 5,
+			},
+		},
+		{
+			Title: "with cache",
+			Input: Input{
+				Cache: NewDataKeyCache(10, time.Minute),
+			},
+			Expect: Expect{
+				DecryptCalls: 1,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			kms := fakekms.New("alias/test")
+			encryptor := NewAWSKMSCryptorWithClient(kms, AWSKMSOptions{
+				KeyID:   "alias/test",
+				DataKey: true,
+			})
+			decryptor := NewAWSKMSCryptorWithClient(kms, AWSKMSOptions{
+				Cache: test.Input.Cache,
+			})
+
+			plaintexts := []string{"a", "b", "c", "d", "e"}
+			ciphers := make([]Ciphertext, len(plaintexts))
+			for i, p := range plaintexts {
+				cipher, err := encryptor.Encrypt(p)
+				assert.Nil(err)
+				ciphers[i] = cipher
+			}
+			assert.Equal(1, kms.Calls("GenerateDataKey"))
+			assert.Equal(0, kms.Calls("Encrypt"))
+
+			for i, cipher := range ciphers {
+				text, err := decryptor.Decrypt(cipher)
+				assert.Nil(err)
+				assert.Equal(plaintexts[i], text)
+			}
+			assert.Equal(test.Expect.DecryptCalls, kms.Calls("Decrypt"))
+
+			tampered, err := DecodeCiphertext(ciphers[0])
+			assert.Nil(err)
+			tampered[len(tampered)-1] ^= 1
+			_, err = decryptor.Decrypt(EncodeCiphertext(tampered))
+			assert.Equal(ErrInvalidEnvelope, err)
+		})
+	}
+}
+
+func TestAWSKMSConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := AWSKMSOptions{
+		Region:   "ap-northeast-1",
+		Endpoint: "http://localhost:4566",
+		RoleARN:  "arn:aws:iam::123456789012:role/gipher",
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Region: aws.String(opts.Region),
+		},
+	})
+	assert.Nil(err)
+
+	config := awsKMSConfig(sess, opts)
+	assert.Equal(opts.Endpoint, aws.StringValue(config.Endpoint))
+	assert.Equal(0, aws.IntValue(config.MaxRetries))
+	assert.NotNil(config.Credentials)
+	// the session is used to assume the role, so it must not have the kms endpoint.
+	assert.Nil(sess.Config.Endpoint)
+}
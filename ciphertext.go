@@ -1,23 +1,152 @@
 package gipher
 
 import (
+	"bytes"
+	"encoding/base32"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"strings"
 )
 
-// Ciphertext is base64-encoded string
+// Ciphertext is an encoded string of encrypted bytes.
+// it is base64-encoded by default. see Encoding for other encodings.
 type Ciphertext []byte
 
+// Encoding is a way to encode encrypted bytes as a text.
+type Encoding string
+
+const (
+	// Base64 is the standard base64 encoding.
+	Base64 Encoding = "base64"
+	// Base64URL is the unpadded url-safe base64 encoding.
+	Base64URL Encoding = "base64url"
+	// Hex is lowercase hex prefixed by "hex:".
+	Hex Encoding = "hex"
+	// Base32 is the standard base32 encoding prefixed by "base32:".
+	Base32 Encoding = "base32"
+	// Armor is base64 text enclosed by BEGIN/END lines.
+	Armor Encoding = "armor"
+)
+
+const (
+	hexPrefix    = "hex:"
+	base32Prefix = "base32:"
+)
+
+func ErrUnknownEncoding(encoding Encoding) error {
+	return fmt.Errorf("unknown encoding: %q", string(encoding))
+}
+
 func EncodeCiphertext(bs []byte) Ciphertext {
 	buf := make([]byte, base64.StdEncoding.EncodedLen(len(bs)))
 	base64.StdEncoding.Encode(buf, bs)
 	return Ciphertext(buf)
 }
 
+// EncodeCiphertextWith encodes bs by encoding.
+func EncodeCiphertextWith(encoding Encoding, bs []byte) (Ciphertext, error) {
+	switch encoding {
+	case Base64:
+		return EncodeCiphertext(bs), nil
+	case Base64URL:
+		return Ciphertext(base64.RawURLEncoding.EncodeToString(bs)), nil
+	case Hex:
+		return Ciphertext(hexPrefix + hex.EncodeToString(bs)), nil
+	case Base32:
+		return Ciphertext(base32Prefix + base32.StdEncoding.EncodeToString(bs)), nil
+	case Armor:
+		buf := &bytes.Buffer{}
+		w, err := NewArmorWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(bs); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return Ciphertext(buf.Bytes()), nil
+	default:
+		return nil, ErrUnknownEncoding(encoding)
+	}
+}
+
+// DecodeCiphertext decodes text encoded by any Encoding, detecting the encoding automatically.
 func DecodeCiphertext(text Ciphertext) ([]byte, error) {
-	ciphertext, err := base64.StdEncoding.DecodeString(string(text))
+	s := string(text)
+	switch {
+	case IsArmored(text):
+		r, err := NewArmorReader(bytes.NewReader(text))
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ciphertext as armor: %s", err)
+		}
+		return ciphertext, nil
+	case strings.HasPrefix(s, hexPrefix):
+		ciphertext, err := hex.DecodeString(s[len(hexPrefix):])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ciphertext as hex: %s", err)
+		}
+		return ciphertext, nil
+	case strings.HasPrefix(s, base32Prefix):
+		ciphertext, err := base32.StdEncoding.DecodeString(s[len(base32Prefix):])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ciphertext as base32: %s", err)
+		}
+		return ciphertext, nil
+	case strings.ContainsAny(s, "-_") || (len(s)%4 != 0 && !strings.ContainsAny(s, "+/=")):
+		// the url-safe alphabet differs from the standard one only in "-" and "_",
+		// and it is unpadded. the strict decoding rejects most words which are not ciphertexts,
+		// since their unused bits are not zero.
+		ciphertext, err := base64.RawURLEncoding.Strict().DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ciphertext as base64url: %s", err)
+		}
+		return ciphertext, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode ciphertext as base64: %s", err)
 	}
 	return ciphertext, nil
 }
+
+type encodingCryptor struct {
+	cryptor  Cryptor
+	encoding Encoding
+}
+
+// NewEncodingCryptor returns a cryptor encoding ciphertexts of c by encoding.
+// Decrypt accepts ciphertexts of any Encoding.
+func NewEncodingCryptor(c Cryptor, encoding Encoding) (Cryptor, error) {
+	if _, err := EncodeCiphertextWith(encoding, nil); err != nil {
+		return nil, err
+	}
+	return encodingCryptor{c, encoding}, nil
+}
+
+func (c encodingCryptor) Encrypt(text string) (Ciphertext, error) {
+	ciphertext, err := c.cryptor.Encrypt(text)
+	if err != nil {
+		return nil, err
+	}
+	if c.encoding == Base64 {
+		return ciphertext, nil
+	}
+	bs, err := DecodeCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeCiphertextWith(c.encoding, bs)
+}
+
+func (c encodingCryptor) Decrypt(ciphertext Ciphertext) (string, error) {
+	return c.cryptor.Decrypt(ciphertext)
+}
@@ -0,0 +1,94 @@
+package gipher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCiphertextEncoding(t *testing.T) {
+	type Input struct {
+		Encoding Encoding
+	}
+	type Expect struct {
+		Pattern string
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title:  "base64",
+			Input:  Input{Base64},
+			Expect: Expect{`\A[0-9a-zA-Z+/]+=*\z`},
+		},
+		{
+			Title:  "base64url",
+			Input:  Input{Base64URL},
+			Expect: Expect{`\A[0-9a-zA-Z_-]+\z`},
+		},
+		{
+			Title:  "hex",
+			Input:  Input{Hex},
+			Expect: Expect{`\Ahex:[0-9a-f]+\z`},
+		},
+		{
+			Title:  "base32",
+			Input:  Input{Base32},
+			Expect: Expect{`\Abase32:[A-Z2-7]+=*\z`},
+		},
+		{
+			Title:  "armor",
+			Input:  Input{Armor},
+			Expect: Expect{`\A-----BEGIN GIPHER ENCRYPTED DATA-----\n[0-9a-zA-Z+/=\n]+-----END GIPHER ENCRYPTED DATA-----\n\z`},
+		},
+	}
+
+	// contains bytes encoded into "+" and "/" by base64.
+	data := []byte{0xfb, 0xff, 0xbf, 0x00, 0x01, 0x02, 0x03}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			text, err := EncodeCiphertextWith(test.Input.Encoding, data)
+			assert.Nil(err)
+			assert.Regexp(test.Expect.Pattern, string(text))
+
+			bs, err := DecodeCiphertext(text)
+			assert.Nil(err)
+			assert.Equal(data, bs)
+		})
+	}
+}
+
+func TestEncodingCryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	password := NewPasswordCryptor([]byte("password"))
+
+	_, err := NewEncodingCryptor(password, Encoding("base128"))
+	assert.Equal(ErrUnknownEncoding("base128"), err)
+
+	cryptor, err := NewEncodingCryptor(password, Hex)
+	assert.Nil(err)
+	cipher, err := cryptor.Encrypt("hello")
+	assert.Nil(err)
+	assert.Regexp(`\Ahex:`, string(cipher))
+
+	text, err := password.Decrypt(cipher)
+	assert.Nil(err)
+	assert.Equal("hello", text)
+}
+
+func TestDecodeCiphertextWords(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, word := range []string{"Secret", "db", "admin", "hello-world"} {
+		_, err := DecodeCiphertext(Ciphertext(word))
+		assert.Error(err, word)
+	}
+}
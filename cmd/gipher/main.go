@@ -6,7 +6,11 @@ import (
 	"github.com/morikuni/gipher/app"
 )
 
+// Version is set by the build.
+var Version = "dev"
+
 func main() {
+	app.Version = Version
 	a := app.NewApp()
 	os.Exit(a.Run(os.Args, os.Stdin, os.Stdout, os.Stderr))
 }
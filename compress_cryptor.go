@@ -0,0 +1,93 @@
+package gipher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// gzipHeader prefixes every ciphertext encrypted with compression enabled.
+// it practically never collides with ciphertexts of other cryptors, which start with a random iv or a version byte of 1.
+// whether a plaintext is actually compressed is recorded by its first byte, which is encrypted,
+// so that ciphertexts do not reveal that plaintexts reached the threshold.
+var gzipHeader = []byte("\x00gipher-gz2")
+
+const (
+	plaintextStored byte = iota
+	plaintextGzipped
+)
+
+type compressCryptor struct {
+	cryptor   Cryptor
+	threshold int
+}
+
+// NewCompressCryptor returns a cryptor compressing plaintexts by gzip before encryption
+// when they are at least threshold bytes and compression makes them smaller.
+// A negative threshold disables compression, and ciphertexts are the same as ones of c.
+// Decrypt decompresses compressed plaintexts regardless of threshold and passes others through.
+func NewCompressCryptor(c Cryptor, threshold int) Cryptor {
+	return compressCryptor{c, threshold}
+}
+
+func (c compressCryptor) Encrypt(text string) (Ciphertext, error) {
+	if c.threshold < 0 {
+		return c.cryptor.Encrypt(text)
+	}
+
+	plaintext := string(plaintextStored) + text
+	if len(text) >= c.threshold {
+		buf := &bytes.Buffer{}
+		buf.WriteByte(plaintextGzipped)
+		w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(text)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(plaintext) {
+			plaintext = buf.String()
+		}
+	}
+	ciphertext, err := c.cryptor.Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return addHeader(gzipHeader, ciphertext)
+}
+
+func (c compressCryptor) Decrypt(ciphertext Ciphertext) (string, error) {
+	ciphertext, hasHeader := cutHeader(gzipHeader, ciphertext)
+	text, err := c.cryptor.Decrypt(ciphertext)
+	if err != nil || !hasHeader {
+		return text, err
+	}
+
+	if len(text) == 0 {
+		return "", errors.New("failed to decompress plaintext: it is empty")
+	}
+	switch text[0] {
+	case plaintextStored:
+		return text[1:], nil
+	case plaintextGzipped:
+	default:
+		return "", fmt.Errorf("failed to decompress plaintext: unknown compression %d", text[0])
+	}
+
+	r, err := gzip.NewReader(strings.NewReader(text[1:]))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress plaintext: %s", err)
+	}
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress plaintext: %s", err)
+	}
+	return string(bs), nil
+}
@@ -0,0 +1,114 @@
+package gipher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressCryptor(t *testing.T) {
+	type Input struct {
+		Plaintext string
+		Threshold int
+	}
+	type Expect struct {
+		Header     bool
+		Compressed bool
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "compressed",
+			Input: Input{
+				Plaintext: strings.Repeat("hello world", 100),
+				Threshold: 100,
+			},
+			Expect: Expect{
+				Header:     true,
+				Compressed: true,
+			},
+		},
+		{
+			Title: "smaller than threshold",
+			Input: Input{
+				Plaintext: "hello world",
+				Threshold: 100,
+			},
+			Expect: Expect{
+				Header:     true,
+				Compressed: false,
+			},
+		},
+		{
+			Title: "not smaller by compression",
+			Input: Input{
+				Plaintext: "abcdefghijklmnopqrstuvwxyz",
+				Threshold: 0,
+			},
+			Expect: Expect{
+				Header:     true,
+				Compressed: false,
+			},
+		},
+		{
+			Title: "disabled",
+			Input: Input{
+				Plaintext: strings.Repeat("hello world", 100),
+				Threshold: -1,
+			},
+			Expect: Expect{
+				Compressed: false,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			password := NewPasswordCryptor([]byte("password"))
+			cryptor := NewCompressCryptor(password, test.Input.Threshold)
+
+			cipher, err := cryptor.Encrypt(test.Input.Plaintext)
+			assert.Nil(err)
+
+			// the header does not tell whether the plaintext is compressed.
+			inner, hasHeader := cutHeader(gzipHeader, cipher)
+			assert.Equal(test.Expect.Header, hasHeader)
+			plaintext, err := password.Decrypt(inner)
+			assert.Nil(err)
+			assert.Equal(test.Expect.Compressed, hasHeader && plaintext[0] == plaintextGzipped)
+
+			// decompression does not depend on the threshold.
+			text, err := NewCompressCryptor(password, -1).Decrypt(cipher)
+			assert.Nil(err)
+			assert.Equal(test.Input.Plaintext, text)
+		})
+	}
+}
+
+func TestCompressCryptorPlaintext(t *testing.T) {
+	assert := assert.New(t)
+
+	// a plaintext which looks compressed is not decompressed unless it was compressed by the cryptor.
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte("hello world"))
+	assert.Nil(err)
+	assert.Nil(w.Close())
+
+	password := NewPasswordCryptor([]byte("password"))
+	cipher, err := password.Encrypt(buf.String())
+	assert.Nil(err)
+	text, err := NewCompressCryptor(password, 0).Decrypt(cipher)
+	assert.Nil(err)
+	assert.Equal(buf.String(), text)
+}
@@ -1,10 +1,34 @@
 package gipher
 
+import "bytes"
+
 // Cryptor encrypts/decrypts a text.
 type Cryptor interface {
 	// Encrypt encrypts a text and encodes it by base64.
+	// NewEncodingCryptor can be used for other encodings.
 	Encrypt(plaintext string) (Ciphertext, error)
 
-	// Decrypt decodes a text by base64 and decrypts it.
+	// Decrypt decodes a text by DecodeCiphertext and decrypts it.
 	Decrypt(ciphertext Ciphertext) (string, error)
 }
+
+// addHeader prefixes the encrypted bytes of ciphertext by header.
+// wrapping cryptors record how they processed plaintexts by headers,
+// so that any plaintext is never taken for a processed one.
+func addHeader(header []byte, ciphertext Ciphertext) (Ciphertext, error) {
+	bs, err := DecodeCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeCiphertext(append(append([]byte{}, header...), bs...)), nil
+}
+
+// cutHeader removes header added by addHeader.
+// ok is false if ciphertext does not start with header.
+func cutHeader(header []byte, ciphertext Ciphertext) (Ciphertext, bool) {
+	bs, err := DecodeCiphertext(ciphertext)
+	if err != nil || !bytes.HasPrefix(bs, header) {
+		return ciphertext, false
+	}
+	return EncodeCiphertext(bs[len(header):]), true
+}
@@ -0,0 +1,130 @@
+package gipher
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DataKeyCache caches unwrapped data keys keyed by the hash of the wrapped key.
+// It is safe for concurrent use and can be shared by several cryptors.
+type DataKeyCache struct {
+	maxEntries int
+	maxAge     time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+	// loading holds calls of Load unwrapping keys not cached yet.
+	loading map[[sha256.Size]byte]*dataKeyLoad
+}
+
+type dataKeyLoad struct {
+	done chan struct{}
+	key  []byte
+	err  error
+}
+
+type dataKeyCacheEntry struct {
+	hash      [sha256.Size]byte
+	key       []byte
+	createdAt time.Time
+}
+
+// NewDataKeyCache returns a cache holding at most maxEntries keys for at most maxAge.
+// maxAge of 0 means keys never expire.
+func NewDataKeyCache(maxEntries int, maxAge time.Duration) *DataKeyCache {
+	return &DataKeyCache{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		now:        time.Now,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		lru:        list.New(),
+		loading:    make(map[[sha256.Size]byte]*dataKeyLoad),
+	}
+}
+
+// Get returns the unwrapped key of wrappedKey if it is cached and not expired.
+func (c *DataKeyCache) Get(wrappedKey []byte) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	hash := sha256.Sum256(wrappedKey)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(hash)
+}
+
+func (c *DataKeyCache) get(hash [sha256.Size]byte) ([]byte, bool) {
+	e, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*dataKeyCacheEntry)
+	if c.maxAge > 0 && c.now().Sub(entry.createdAt) > c.maxAge {
+		c.lru.Remove(e)
+		delete(c.entries, hash)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.key, true
+}
+
+// Load returns the unwrapped key of wrappedKey if it is cached,
+// or calls unwrap and caches the key returned by it.
+// concurrent calls for the same wrapped key wait for a single call of unwrap.
+func (c *DataKeyCache) Load(wrappedKey []byte, unwrap func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return unwrap()
+	}
+	hash := sha256.Sum256(wrappedKey)
+
+	c.mu.Lock()
+	if key, ok := c.get(hash); ok {
+		c.mu.Unlock()
+		return key, nil
+	}
+	if l, ok := c.loading[hash]; ok {
+		c.mu.Unlock()
+		<-l.done
+		return l.key, l.err
+	}
+	l := &dataKeyLoad{done: make(chan struct{})}
+	c.loading[hash] = l
+	c.mu.Unlock()
+
+	l.key, l.err = unwrap()
+	if l.err == nil {
+		c.Put(wrappedKey, l.key)
+	}
+	c.mu.Lock()
+	delete(c.loading, hash)
+	c.mu.Unlock()
+	close(l.done)
+	return l.key, l.err
+}
+
+// Put caches key as the unwrapped key of wrappedKey,
+// evicting the least recently used key if the cache is full.
+func (c *DataKeyCache) Put(wrappedKey, key []byte) {
+	if c == nil || c.maxEntries < 1 {
+		return
+	}
+	hash := sha256.Sum256(wrappedKey)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[hash]; ok {
+		c.lru.Remove(e)
+	}
+	c.entries[hash] = c.lru.PushFront(&dataKeyCacheEntry{hash, key, c.now()})
+	for c.lru.Len() > c.maxEntries {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*dataKeyCacheEntry).hash)
+	}
+}
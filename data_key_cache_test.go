@@ -0,0 +1,85 @@
+package gipher
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataKeyCache(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewDataKeyCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Put([]byte("wrapped1"), []byte("key1"))
+	cache.Put([]byte("wrapped2"), []byte("key2"))
+
+	key, ok := cache.Get([]byte("wrapped1"))
+	assert.True(ok)
+	assert.Equal([]byte("key1"), key)
+
+	// wrapped2 is the least recently used.
+	cache.Put([]byte("wrapped3"), []byte("key3"))
+	_, ok = cache.Get([]byte("wrapped2"))
+	assert.False(ok)
+	_, ok = cache.Get([]byte("wrapped1"))
+	assert.True(ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get([]byte("wrapped1"))
+	assert.False(ok)
+
+	var disabled *DataKeyCache
+	disabled.Put([]byte("wrapped1"), []byte("key1"))
+	_, ok = disabled.Get([]byte("wrapped1"))
+	assert.False(ok)
+}
+
+func TestDataKeyCacheLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := NewDataKeyCache(10, time.Minute)
+	var calls int32
+	release := make(chan struct{})
+	unwrap := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte("key"), nil
+	}
+
+	wg := &sync.WaitGroup{}
+	keys := make([][]byte, 10)
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key, err := cache.Load([]byte("wrapped"), unwrap)
+			assert.Nil(err)
+			keys[i] = key
+		}(i)
+	}
+	// wait until a call of unwrap starts, then let the others pile up behind it.
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+	for _, key := range keys {
+		assert.Equal([]byte("key"), key)
+	}
+
+	fail := errors.New("fail")
+	_, err := cache.Load([]byte("other"), func() ([]byte, error) { return nil, fail })
+	assert.Equal(fail, err)
+	_, ok := cache.Get([]byte("other"))
+	assert.False(ok)
+}
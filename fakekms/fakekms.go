@@ -0,0 +1,210 @@
+// Package fakekms provides an in-memory implementation of aws kms
+// for testing code which uses kms without network access.
+package fakekms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// KMS is an in-memory kms.
+// Only Encrypt, Decrypt and GenerateDataKey are implemented,
+// the other methods of kmsiface.KMSAPI panic.
+type KMS struct {
+	kmsiface.KMSAPI
+
+	mu     sync.Mutex
+	keys   map[string][]byte
+	errors []error
+	calls  map[string]int
+}
+
+// New returns a KMS having keys identified by keyIDs.
+func New(keyIDs ...string) *KMS {
+	k := &KMS{
+		keys:  make(map[string][]byte),
+		calls: make(map[string]int),
+	}
+	for _, id := range keyIDs {
+		k.AddKey(id)
+	}
+	return k
+}
+
+// AddKey adds a new random key identified by keyID.
+func (k *KMS) AddKey(keyID string) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		panic(err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[keyID] = key
+}
+
+// InjectError makes the next call fail with err.
+// Errors are returned in the order they were injected, one per call.
+func (k *KMS) InjectError(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.errors = append(k.errors, err)
+}
+
+// Calls returns the number of calls of the operation (e.g. "Decrypt"),
+// including calls which failed.
+func (k *KMS) Calls(operation string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.calls[operation]
+}
+
+// ThrottlingError is an error returned by kms when requests are throttled.
+func ThrottlingError() error {
+	return awserr.New("ThrottlingException", "rate exceeded", nil)
+}
+
+func (k *KMS) begin(operation string) error {
+	k.calls[operation]++
+	if len(k.errors) > 0 {
+		err := k.errors[0]
+		k.errors = k.errors[1:]
+		return err
+	}
+	return nil
+}
+
+func (k *KMS) aead(keyID string) (cipher.AEAD, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, awserr.New("NotFoundException", "key not found: "+keyID, nil)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext into the blob: keyID length (2 bytes) | keyID | nonce | sealed.
+func (k *KMS) seal(keyID string, plaintext []byte) ([]byte, error) {
+	aead, err := k.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, 2+len(keyID)+aead.NonceSize())
+	binary.BigEndian.PutUint16(blob, uint16(len(keyID)))
+	copy(blob[2:], keyID)
+	nonce := blob[2+len(keyID):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(blob, nonce, plaintext, []byte(keyID)), nil
+}
+
+func (k *KMS) open(blob []byte) (string, []byte, error) {
+	invalid := awserr.New("InvalidCiphertextException", "invalid ciphertext", nil)
+
+	if len(blob) < 2 {
+		return "", nil, invalid
+	}
+	n := int(binary.BigEndian.Uint16(blob))
+	if len(blob) < 2+n {
+		return "", nil, invalid
+	}
+	keyID := string(blob[2 : 2+n])
+	aead, err := k.aead(keyID)
+	if err != nil {
+		return "", nil, invalid
+	}
+	rest := blob[2+n:]
+	if len(rest) < aead.NonceSize() {
+		return "", nil, invalid
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", nil, invalid
+	}
+	return keyID, plaintext, nil
+}
+
+func (k *KMS) Encrypt(input *kms.EncryptInput) (*kms.EncryptOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.begin("Encrypt"); err != nil {
+		return nil, err
+	}
+
+	keyID := aws.StringValue(input.KeyId)
+	blob, err := k.seal(keyID, input.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{
+		CiphertextBlob: blob,
+		KeyId:          aws.String(keyID),
+	}, nil
+}
+
+func (k *KMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.begin("Decrypt"); err != nil {
+		return nil, err
+	}
+
+	keyID, plaintext, err := k.open(input.CiphertextBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(keyID),
+		Plaintext: plaintext,
+	}, nil
+}
+
+func (k *KMS) GenerateDataKey(input *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.begin("GenerateDataKey"); err != nil {
+		return nil, err
+	}
+
+	var size int
+	switch {
+	case input.NumberOfBytes != nil:
+		size = int(*input.NumberOfBytes)
+	case aws.StringValue(input.KeySpec) == kms.DataKeySpecAes256:
+		size = 32
+	case aws.StringValue(input.KeySpec) == kms.DataKeySpecAes128:
+		size = 16
+	default:
+		return nil, errors.New("KeySpec or NumberOfBytes is required")
+	}
+
+	plaintext := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+		return nil, err
+	}
+	keyID := aws.StringValue(input.KeyId)
+	blob, err := k.seal(keyID, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: blob,
+		KeyId:          aws.String(keyID),
+		Plaintext:      plaintext,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package fakekms
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKMS(t *testing.T) {
+	assert := assert.New(t)
+
+	k := New("key1", "key2")
+
+	enc, err := k.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String("key2"),
+		Plaintext: []byte("hello"),
+	})
+	assert.Nil(err)
+
+	dec, err := k.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: enc.CiphertextBlob,
+	})
+	assert.Nil(err)
+	assert.Equal("key2", aws.StringValue(dec.KeyId))
+	assert.Equal([]byte("hello"), dec.Plaintext)
+
+	dk, err := k.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String("key1"),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	assert.Nil(err)
+	assert.Len(dk.Plaintext, 32)
+
+	dec, err = k.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: dk.CiphertextBlob,
+	})
+	assert.Nil(err)
+	assert.Equal(dk.Plaintext, dec.Plaintext)
+
+	_, err = k.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String("unknown"),
+		Plaintext: []byte("hello"),
+	})
+	assert.Equal("NotFoundException", err.(awserr.Error).Code())
+
+	blob := append([]byte{}, enc.CiphertextBlob...)
+	blob[len(blob)-1] ^= 1
+	_, err = k.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: blob,
+	})
+	assert.Equal("InvalidCiphertextException", err.(awserr.Error).Code())
+
+	k.InjectError(ThrottlingError())
+	_, err = k.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: enc.CiphertextBlob,
+	})
+	assert.Equal(ThrottlingError(), err)
+
+	assert.Equal(2, k.Calls("Encrypt"))
+	assert.Equal(4, k.Calls("Decrypt"))
+	assert.Equal(1, k.Calls("GenerateDataKey"))
+}
@@ -0,0 +1,30 @@
+package gipher
+
+import "strings"
+
+const (
+	markerPrefix = "ENC["
+	markerSuffix = "]"
+)
+
+// Mark wraps ciphertext by a marker like "ENC[...]"
+// so that encrypted values are distinguished from plaintexts.
+func Mark(ciphertext Ciphertext) string {
+	return markerPrefix + string(ciphertext) + markerSuffix
+}
+
+// IsMarked reports whether text is wrapped by Mark.
+func IsMarked(text string) bool {
+	return len(text) >= len(markerPrefix)+len(markerSuffix) &&
+		strings.HasPrefix(text, markerPrefix) &&
+		strings.HasSuffix(text, markerSuffix)
+}
+
+// Unmark returns the ciphertext wrapped by Mark.
+// ok is false if text is not marked.
+func Unmark(text string) (ciphertext Ciphertext, ok bool) {
+	if !IsMarked(text) {
+		return nil, false
+	}
+	return Ciphertext(text[len(markerPrefix) : len(text)-len(markerSuffix)]), true
+}
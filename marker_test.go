@@ -0,0 +1,57 @@
+package gipher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarker(t *testing.T) {
+	type Input struct {
+		Text string
+	}
+	type Expect struct {
+		Ciphertext Ciphertext
+		OK         bool
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title:  "marked",
+			Input:  Input{Mark(Ciphertext("aGVsbG8="))},
+			Expect: Expect{Ciphertext("aGVsbG8="), true},
+		},
+		{
+			Title:  "empty marked",
+			Input:  Input{"ENC[]"},
+			Expect: Expect{Ciphertext(""), true},
+		},
+		{
+			Title:  "not marked",
+			Input:  Input{"aGVsbG8="},
+			Expect: Expect{nil, false},
+		},
+		{
+			Title:  "only prefix",
+			Input:  Input{"ENC["},
+			Expect: Expect{nil, false},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			ciphertext, ok := Unmark(test.Input.Text)
+
+			assert.Equal(test.Expect.Ciphertext, ciphertext)
+			assert.Equal(test.Expect.OK, ok)
+			assert.Equal(test.Expect.OK, IsMarked(test.Input.Text))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package gipher
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// padHeader prefixes ciphertexts of plaintexts padded before encryption.
+// padded plaintexts start with the length of the original plaintext (4 bytes),
+// which is encrypted so that it is not revealed.
+var padHeader = []byte("\x00gipher-pad1")
+
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// Padding returns the padded length of a plaintext of n bytes.
+// The result must not be less than n.
+type Padding func(n int) int
+
+// PadToMultiple pads plaintexts to a multiple of size.
+func PadToMultiple(size int) Padding {
+	return func(n int) int {
+		if size < 1 {
+			return n
+		}
+		return (n + size - 1) / size * size
+	}
+}
+
+// PadToBuckets pads plaintexts to the smallest bucket not less than them.
+// Plaintexts larger than every bucket are padded to a multiple of the largest bucket.
+func PadToBuckets(buckets ...int) Padding {
+	sorted := append([]int{}, buckets...)
+	sort.Ints(sorted)
+	return func(n int) int {
+		for _, b := range sorted {
+			if n <= b {
+				return b
+			}
+		}
+		if len(sorted) == 0 {
+			return n
+		}
+		return PadToMultiple(sorted[len(sorted)-1])(n)
+	}
+}
+
+type padCryptor struct {
+	cryptor Cryptor
+	padding Padding
+}
+
+// NewPadCryptor returns a cryptor padding plaintexts by padding before encryption
+// so that the length of ciphertexts does not reveal the exact length of plaintexts.
+// A nil padding disables padding.
+// Decrypt strips padding regardless of padding and passes unpadded plaintexts through.
+func NewPadCryptor(c Cryptor, padding Padding) Cryptor {
+	return padCryptor{c, padding}
+}
+
+func (c padCryptor) Encrypt(text string) (Ciphertext, error) {
+	if c.padding == nil {
+		return c.cryptor.Encrypt(text)
+	}
+
+	size := c.padding(len(text))
+	if size < len(text) {
+		size = len(text)
+	}
+	buf := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(buf, uint32(len(text)))
+	copy(buf[4:], text)
+	ciphertext, err := c.cryptor.Encrypt(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return addHeader(padHeader, ciphertext)
+}
+
+func (c padCryptor) Decrypt(ciphertext Ciphertext) (string, error) {
+	ciphertext, padded := cutHeader(padHeader, ciphertext)
+	text, err := c.cryptor.Decrypt(ciphertext)
+	if err != nil || !padded {
+		return text, err
+	}
+
+	if len(text) < 4 {
+		return "", ErrInvalidPadding
+	}
+	n := int(binary.BigEndian.Uint32([]byte(text[:4])))
+	text = text[4:]
+	if n > len(text) {
+		return "", ErrInvalidPadding
+	}
+	return text[:n], nil
+}
@@ -0,0 +1,83 @@
+package gipher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPadding(t *testing.T) {
+	type Input struct {
+		Padding Padding
+		Length  int
+	}
+	type Expect struct {
+		Length int
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title:  "multiple",
+			Input:  Input{PadToMultiple(16), 17},
+			Expect: Expect{32},
+		},
+		{
+			Title:  "multiple exact",
+			Input:  Input{PadToMultiple(16), 16},
+			Expect: Expect{16},
+		},
+		{
+			Title:  "bucket",
+			Input:  Input{PadToBuckets(64, 16, 256), 17},
+			Expect: Expect{64},
+		},
+		{
+			Title:  "larger than buckets",
+			Input:  Input{PadToBuckets(16, 64), 65},
+			Expect: Expect{128},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.Equal(test.Expect.Length, test.Input.Padding(test.Input.Length))
+		})
+	}
+}
+
+func TestPadCryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	password := NewPasswordCryptor([]byte("password"))
+	cryptor := NewPadCryptor(password, PadToMultiple(32))
+
+	pin, err := cryptor.Encrypt("1234")
+	assert.Nil(err)
+	token, err := cryptor.Encrypt("abcdefghijklmnopqrstuvwxyz")
+	assert.Nil(err)
+	assert.Equal(len(pin), len(token))
+
+	text, err := NewPadCryptor(password, nil).Decrypt(pin)
+	assert.Nil(err)
+	assert.Equal("1234", text)
+
+	unpadded, err := password.Encrypt("1234")
+	assert.Nil(err)
+	text, err = cryptor.Decrypt(unpadded)
+	assert.Nil(err)
+	assert.Equal("1234", text)
+
+	// a plaintext which looks padded is not unpadded unless it was padded by the cryptor.
+	looksPadded, err := password.Encrypt("\x00\x00\x00\x011234")
+	assert.Nil(err)
+	text, err = cryptor.Decrypt(looksPadded)
+	assert.Nil(err)
+	assert.Equal("\x00\x00\x00\x011234", text)
+}
@@ -16,6 +16,7 @@ import (
 var (
 	ErrCannotReadPassword = errors.New("cannot read the password. use GIPHER_PASSWORD to set the password if you did not use a terminal.")
 	ErrPasswordIsEmpty    = errors.New("password is empty")
+	ErrCiphertextTooShort = errors.New("ciphertext is too short")
 )
 
 type passwordCryptor struct {
@@ -78,6 +79,9 @@ func (c passwordCryptor) Decrypt(text Ciphertext) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if len(ciphertext) < aes.BlockSize {
+		return "", ErrCiphertextTooShort
+	}
 	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
 
 	iv := ciphertext[:aes.BlockSize]
@@ -49,3 +49,10 @@ func TestPasswordCryptor(t *testing.T) {
 		})
 	}
 }
+
+func TestPasswordCryptorShortCiphertext(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewPasswordCryptor([]byte("password")).Decrypt(Ciphertext("AAAA"))
+	assert.Equal(ErrCiphertextTooShort, err)
+}
@@ -0,0 +1,62 @@
+package gipher
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures retries with exponential backoff and jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// values less than 1 are treated as 1.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used when no retry policy is specified.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// RetryCounter is implemented by cryptors which retry failed requests.
+type RetryCounter interface {
+	// Retries returns the total number of retries so far.
+	Retries() int
+}
+
+// delay returns the backoff before the n-th retry (starting from 0),
+// chosen randomly from [0, min(MaxDelay, BaseDelay*2^n)).
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// do calls fn until it succeeds, fails with an error not accepted by isRetryable,
+// or reaches MaxAttempts. It returns the number of retries and the last error.
+func (p RetryPolicy) do(isRetryable func(error) bool, sleep func(time.Duration), fn func() error) (int, error) {
+	retries := 0
+	for {
+		err := fn()
+		if err == nil || !isRetryable(err) || retries+1 >= p.MaxAttempts {
+			return retries, err
+		}
+		sleep(p.delay(retries))
+		retries++
+	}
+}
@@ -0,0 +1,115 @@
+package gipher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	retryable := errors.New("retryable")
+	fatal := errors.New("fatal")
+
+	type Input struct {
+		MaxAttempts int
+		Errors      []error
+	}
+	type Expect struct {
+		Retries int
+		Err     error
+	}
+	type Test struct {
+		Title  string
+		Input  Input
+		Expect Expect
+	}
+
+	table := []Test{
+		{
+			Title: "success",
+			Input: Input{
+				MaxAttempts: 3,
+				Errors:      []error{nil},
+			},
+			Expect: Expect{
+				Retries: 0,
+				Err:     nil,
+			},
+		},
+		{
+			Title: "success after retries",
+			Input: Input{
+				MaxAttempts: 3,
+				Errors:      []error{retryable, retryable, nil},
+			},
+			Expect: Expect{
+				Retries: 2,
+				Err:     nil,
+			},
+		},
+		{
+			Title: "too many attempts",
+			Input: Input{
+				MaxAttempts: 3,
+				Errors:      []error{retryable, retryable, retryable, nil},
+			},
+			Expect: Expect{
+				Retries: 2,
+				Err:     retryable,
+			},
+		},
+		{
+			Title: "not retryable",
+			Input: Input{
+				MaxAttempts: 3,
+				Errors:      []error{retryable, fatal, nil},
+			},
+			Expect: Expect{
+				Retries: 1,
+				Err:     fatal,
+			},
+		},
+		{
+			Title: "no retry",
+			Input: Input{
+				MaxAttempts: 0,
+				Errors:      []error{retryable, nil},
+			},
+			Expect: Expect{
+				Retries: 0,
+				Err:     retryable,
+			},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			policy := RetryPolicy{
+				MaxAttempts: test.Input.MaxAttempts,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    4 * time.Millisecond,
+			}
+			var delays []time.Duration
+			sleep := func(d time.Duration) { delays = append(delays, d) }
+			isRetryable := func(err error) bool { return err == retryable }
+
+			i := 0
+			retries, err := policy.do(isRetryable, sleep, func() error {
+				err := test.Input.Errors[i]
+				i++
+				return err
+			})
+
+			assert.Equal(test.Expect.Retries, retries)
+			assert.Equal(test.Expect.Err, err)
+			assert.Len(delays, test.Expect.Retries)
+			for _, d := range delays {
+				assert.True(d < policy.MaxDelay)
+			}
+		})
+	}
+}
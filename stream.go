@@ -0,0 +1,246 @@
+package gipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamChunkSize is the size of plaintext encrypted as one chunk of a stream.
+const StreamChunkSize = 64 * 1024
+
+var (
+	ErrInvalidStream   = errors.New("invalid encrypted stream")
+	ErrTruncatedStream = errors.New("encrypted stream is truncated")
+)
+
+// streamMagic prefixes an encrypted stream.
+var streamMagic = []byte("GIPHERSTREAM1\n")
+
+// IsEncryptedStream reports whether data starts like the output of NewEncryptWriter.
+func IsEncryptedStream(data []byte) bool {
+	return bytes.HasPrefix(data, streamMagic)
+}
+
+const (
+	streamNonceSize = 12
+	streamTagSize   = 16
+	// maxWrappedKeySize limits the header so that a broken stream cannot make us allocate too much.
+	maxWrappedKeySize = 64 * 1024
+)
+
+// An encrypted stream consists of a header and chunks.
+//
+//	header: magic | length of wrapped key (4 bytes) | wrapped key
+//	chunk:  length of sealed chunk (4 bytes) | sealed chunk
+//
+// Each chunk is sealed by AES-GCM with a random key which is wrapped by the Cryptor.
+// The nonce is the chunk counter followed by a flag marking the last chunk,
+// and the hash of the header is authenticated with every chunk,
+// so reordering, truncating or replacing chunks is detected.
+
+func streamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, streamNonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot accept the stream key: %s", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	ad      []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer encrypting data written to it into w
+// in chunks of StreamChunkSize, using constant memory.
+// Close must be called to write the last chunk. It does not close w.
+func NewEncryptWriter(w io.Writer, c Cryptor) (io.WriteCloser, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := c.Encrypt(string(key))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(streamMagic)+4+len(wrapped))
+	copy(header, streamMagic)
+	binary.BigEndian.PutUint32(header[len(streamMagic):], uint32(len(wrapped)))
+	copy(header[len(streamMagic)+4:], wrapped)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	ad := sha256.Sum256(header)
+
+	return &encryptWriter{
+		w:    w,
+		aead: aead,
+		ad:   ad[:],
+		buf:  make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		// a full buffer is written only when more data follows,
+		// because the last chunk must be marked on Close.
+		if len(w.buf) == StreamChunkSize {
+			if err := w.writeChunk(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):StreamChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) writeChunk(last bool) error {
+	sealed := w.aead.Seal(make([]byte, 4, 4+len(w.buf)+streamTagSize), streamNonce(w.counter, last), w.buf, w.ad)
+	binary.BigEndian.PutUint32(sealed, uint32(len(sealed)-4))
+	if _, err := w.w.Write(sealed); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.writeChunk(true)
+}
+
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	ad      []byte
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+// NewDecryptReader returns a reader decrypting a stream written by NewEncryptWriter.
+// It returns ErrTruncatedStream if r ends before the last chunk.
+func NewDecryptReader(r io.Reader, c Cryptor) (io.Reader, error) {
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, streamMagic) {
+		return nil, ErrInvalidStream
+	}
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, ErrInvalidStream
+	}
+	n := binary.BigEndian.Uint32(size)
+	if n > maxWrappedKeySize {
+		return nil, ErrInvalidStream
+	}
+	wrapped := make([]byte, n)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, ErrInvalidStream
+	}
+
+	key, err := c.Decrypt(Ciphertext(wrapped))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(magic)
+	h.Write(size)
+	h.Write(wrapped)
+
+	return &decryptReader{
+		r:    r,
+		aead: aead,
+		ad:   h.Sum(nil),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *decryptReader) readChunk() error {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r.r, size); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncatedStream
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(size)
+	if n < streamTagSize || n > StreamChunkSize+streamTagSize {
+		return ErrInvalidStream
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncatedStream
+		}
+		return err
+	}
+
+	plaintext, err := r.aead.Open(nil, streamNonce(r.counter, false), sealed, r.ad)
+	if err != nil {
+		plaintext, err = r.aead.Open(nil, streamNonce(r.counter, true), sealed, r.ad)
+		if err != nil {
+			return ErrInvalidStream
+		}
+		r.done = true
+		if _, err := io.ReadFull(r.r, make([]byte, 1)); err != io.EOF {
+			return ErrInvalidStream
+		}
+	}
+	r.counter++
+	r.buf = plaintext
+	return nil
+}
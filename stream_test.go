@@ -0,0 +1,76 @@
+package gipher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	type Input struct {
+		Size int
+	}
+	type Test struct {
+		Title string
+		Input Input
+	}
+
+	table := []Test{
+		{
+			Title: "empty",
+			Input: Input{0},
+		},
+		{
+			Title: "smaller than a chunk",
+			Input: Input{100},
+		},
+		{
+			Title: "exactly a chunk",
+			Input: Input{StreamChunkSize},
+		},
+		{
+			Title: "several chunks",
+			Input: Input{3*StreamChunkSize + 5},
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Title, func(t *testing.T) {
+			assert := assert.New(t)
+
+			plaintext := make([]byte, test.Input.Size)
+			for i := range plaintext {
+				plaintext[i] = byte(i)
+			}
+			cryptor := NewPasswordCryptor([]byte("password"))
+
+			encrypted := &bytes.Buffer{}
+			w, err := NewEncryptWriter(encrypted, cryptor)
+			assert.Nil(err)
+			_, err = w.Write(plaintext)
+			assert.Nil(err)
+			assert.Nil(w.Close())
+			assert.True(IsEncryptedStream(encrypted.Bytes()))
+
+			r, err := NewDecryptReader(bytes.NewReader(encrypted.Bytes()), cryptor)
+			assert.Nil(err)
+			decrypted, err := ioutil.ReadAll(r)
+			assert.Nil(err)
+			assert.Equal(plaintext, decrypted)
+
+			r, err = NewDecryptReader(bytes.NewReader(encrypted.Bytes()[:encrypted.Len()-1]), cryptor)
+			assert.Nil(err)
+			_, err = ioutil.ReadAll(r)
+			assert.Equal(ErrTruncatedStream, err)
+
+			tampered := append([]byte{}, encrypted.Bytes()...)
+			tampered[len(tampered)-1] ^= 1
+			r, err = NewDecryptReader(bytes.NewReader(tampered), cryptor)
+			assert.Nil(err)
+			_, err = ioutil.ReadAll(r)
+			assert.Equal(ErrInvalidStream, err)
+		})
+	}
+}